@@ -0,0 +1,317 @@
+// Assets and asset types
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// An Asset is a maintained device at a station, e.g. an escalator, an elevator or a ticket machine. Tickets name the
+// asset in need of repairs by its AssetID (Ticket.Device).
+type Asset struct {
+	AssetID      string
+	AssetType    string // see AssetType, "ESCALATOR" for all assets created before asset types existed
+	Trainstation string // name of the station, see Station
+	Platform     string // name of the platform, see Platform
+	StationID    string
+	PlatformID   string
+	IsWorking    bool
+	MasterData
+	Attributes         map[string]string // type-specific attributes, see AssetType.Attributes
+	DecommissionedAt   int64
+	DecommissionReason string
+	PredecessorID      string // asset this one replaced, see replaceAsset
+	SuccessorID        string // asset that replaced this one
+}
+
+// MasterData are the descriptive fields every Asset has, maintained with updateAsset.
+type MasterData struct {
+	Manufacturer        string
+	Model               string
+	SerialNumber        string
+	InstallationDate    string // YYYY-MM-DD
+	MaintenanceProvider string // service provider contracted for the maintenance, needs a SLA
+	CommissioningStatus string // "PLANNED", "IN_SERVICE" or "OUT_OF_SERVICE", "DECOMMISSIONED" once retired
+}
+
+// An AssetType defines the attributes of a kind of asset. The error codes of the type are kept in the error code
+// catalogue, see ErrorCode.
+type AssetType struct {
+	AssetType  string // e.g. "ELEVATOR"
+	Name       string
+	Attributes []AttributeDefinition
+}
+
+// An AttributeDefinition names an attribute assets of a type may or must have.
+type AttributeDefinition struct {
+	Name        string
+	Description string
+	Required    bool
+}
+
+const assetTypeEscalator = "ESCALATOR"
+
+// asset types every ledger starts with, see Init
+var builtinAssetTypes = []AssetType{
+	{
+		AssetType: assetTypeEscalator,
+		Name:      "Rolltreppe",
+		Attributes: []AttributeDefinition{
+			{Name: "Rise", Description: "height between the landings in meters"},
+			{Name: "StepWidth", Description: "width of the steps in millimeters"},
+		},
+	},
+	{
+		AssetType: "ELEVATOR",
+		Name:      "Aufzug",
+		Attributes: []AttributeDefinition{
+			{Name: "LoadCapacity", Description: "rated load in kilograms", Required: true},
+			{Name: "Stops", Description: "number of landings served"},
+		},
+	},
+	{
+		AssetType: "AUTOMATIC_DOOR",
+		Name:      "Automatiktuer",
+		Attributes: []AttributeDefinition{
+			{Name: "DoorType", Description: "sliding, swing or revolving door", Required: true},
+		},
+	},
+	{
+		AssetType: "TICKET_MACHINE",
+		Name:      "Fahrkartenautomat",
+		Attributes: []AttributeDefinition{
+			{Name: "PaymentMethods", Description: "accepted payment methods, e.g. cash, card"},
+		},
+	},
+}
+
+// commissioning status values (Asset.CommissioningStatus)
+const (
+	commissioningPlanned      = "PLANNED"        // installed, but not yet handed over for operation
+	commissioningInService    = "IN_SERVICE"     // in regular operation
+	commissioningOutOfService = "OUT_OF_SERVICE" // taken out of operation for a longer time, e.g. during modernisation
+)
+
+const installationDateLayout = "2006-01-02"
+
+// Create or replace an asset type. Input is the AssetType as JSON. Changed attribute definitions apply to assets the
+// next time they are created or updated.
+func (t *SimpleChaincode) defineAssetType(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Wrong number of arguments, must be 1: asset type as JSON")
+	}
+	var assetType AssetType
+	if err := json.Unmarshal([]byte(args[0]), &assetType); err != nil {
+		return nil, errors.New("Asset type is no valid JSON: " + err.Error())
+	}
+	assetType.AssetType = strings.ToUpper(strings.TrimSpace(assetType.AssetType))
+	if assetType.AssetType == "" || strings.ContainsAny(assetType.AssetType, "/~") {
+		return nil, errors.New("AssetType must not be empty or contain / or ~")
+	}
+	names := map[string]bool{}
+	for _, attribute := range assetType.Attributes {
+		if attribute.Name == "" || names[attribute.Name] {
+			return nil, errors.New("Attribute names of asset type " + assetType.AssetType + " must be unique and not empty")
+		}
+		names[attribute.Name] = true
+	}
+	return nil, putAssetType(stub, &assetType)
+}
+
+// returns all asset types, ordered by AssetType
+func (t *SimpleChaincode) getAssetTypes(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	return getRangeAsJSONArray(stub, assetTypeKey(""), assetTypeKey("~"))
+}
+
+// Register an asset. Arguments are the AssetType, Trainstation and Platform (registered IDs or names) and optionally
+// master data and attributes as JSON (see updateAsset). Returns the AssetID of the new asset.
+func (t *SimpleChaincode) createAsset(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 3 && len(args) != 4 {
+		return nil, errors.New("Wrong number of arguments, must be 3 or 4: AssetType, Trainstation, Platform and optionally master data as JSON")
+	}
+	assetType, err := getAssetType(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	station, platform, err := resolveLocation(stub, args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	var asset = Asset{
+		AssetType:    assetType.AssetType,
+		Trainstation: station.Name,
+		Platform:     platform.Name,
+		StationID:    station.StationID,
+		PlatformID:   platform.PlatformID,
+		IsWorking:    true,
+	}
+	asset.CommissioningStatus = commissioningInService
+	data := "{}"
+	if len(args) == 4 {
+		data = args[3]
+	}
+	if err = asset.applyAssetData(stub, assetType, data); err != nil {
+		return nil, err
+	}
+	idAsString, _ := createID(stub, "asset")
+	asset.AssetID = station.StationID + idAsString //Id is the StationID + a sequential ID, unique over all asset types
+
+	return []byte(asset.AssetID), putAsset(stub, &asset, "createAsset")
+}
+
+// Update the master data and attributes of an asset. Arguments are the AssetID and a JSON object with the fields of
+// MasterData to change and optionally "Attributes", an object with the attributes to change; fields and attributes
+// missing in the object keep their current value, attributes set to "" are removed.
+func (t *SimpleChaincode) updateAsset(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 2 {
+		return nil, errors.New("Wrong number of arguments, must be 2: AssetID and master data as JSON")
+	}
+	asset, err := getAsset(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if asset.isDecommissioned() {
+		return nil, errors.New("Asset " + args[0] + " is decommissioned")
+	}
+	assetType, err := getAssetType(stub, asset.AssetType)
+	if err != nil {
+		return nil, err
+	}
+	if err = asset.applyAssetData(stub, assetType, args[1]); err != nil {
+		return nil, err
+	}
+	return nil, putAsset(stub, asset, "updateAsset")
+}
+
+// returns the full record of an asset including its master data and attributes. Input is the AssetID.
+func (t *SimpleChaincode) getAsset(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Wrong number of arguments, must be 1: AssetID")
+	}
+	asset, err := getAsset(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(asset)
+}
+
+// returns all assets, ordered by AssetID. Input is optionally an AssetType to return only the assets of that type.
+func (t *SimpleChaincode) getAssets(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) > 1 {
+		return nil, errors.New("Wrong number of arguments, must be 0 or 1: optionally an AssetType")
+	}
+	assets := []Asset{}
+	err := forEachInRange(stub, assetPrefix, assetPrefix+"~", func(assetAsByteArr []byte) error {
+		var asset Asset
+		if err := json.Unmarshal(assetAsByteArr, &asset); err != nil {
+			return err
+		}
+		if len(args) == 0 || strings.EqualFold(asset.AssetType, args[0]) {
+			assets = append(assets, asset)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(assets)
+}
+
+// applyAssetData merges the JSON encoded master data and attributes into the asset and validates the result.
+func (asset *Asset) applyAssetData(stub shim.ChaincodeStubInterface, assetType *AssetType, data string) error {
+	var attributes struct {
+		Attributes map[string]string
+	}
+	if err := json.Unmarshal([]byte(data), &attributes); err != nil {
+		return errors.New("Master data is no valid JSON: " + err.Error())
+	}
+	if err := json.Unmarshal([]byte(data), &asset.MasterData); err != nil {
+		return errors.New("Master data is no valid JSON: " + err.Error())
+	}
+	asset.CommissioningStatus = strings.ToUpper(asset.CommissioningStatus)
+	switch asset.CommissioningStatus {
+	case commissioningPlanned, commissioningInService, commissioningOutOfService:
+	default:
+		return errors.New("Unknown CommissioningStatus " + asset.CommissioningStatus + ", must be PLANNED, IN_SERVICE or OUT_OF_SERVICE")
+	}
+	if asset.InstallationDate != "" {
+		if _, err := time.Parse(installationDateLayout, asset.InstallationDate); err != nil {
+			return errors.New("InstallationDate " + asset.InstallationDate + " is no date of the form YYYY-MM-DD")
+		}
+	}
+	if asset.MaintenanceProvider != "" {
+		if _, err := getServiceLevelAgreement(stub, asset.MaintenanceProvider); err != nil {
+			return errors.New("MaintenanceProvider " + asset.MaintenanceProvider + " has no SLA")
+		}
+	}
+
+	for name, value := range attributes.Attributes {
+		if asset.Attributes == nil {
+			asset.Attributes = map[string]string{}
+		}
+		if value == "" {
+			delete(asset.Attributes, name)
+		} else {
+			asset.Attributes[name] = value
+		}
+	}
+	return assetType.validateAttributes(asset.Attributes)
+}
+
+// validateAttributes rejects attributes the type does not define and reports missing required ones.
+func (assetType *AssetType) validateAttributes(attributes map[string]string) error {
+	defined := map[string]bool{}
+	var missing []string
+	for _, definition := range assetType.Attributes {
+		defined[definition.Name] = true
+		if definition.Required && attributes[definition.Name] == "" {
+			missing = append(missing, definition.Name)
+		}
+	}
+	var unknown []string
+	for name := range attributes {
+		if !defined[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	if len(unknown) > 0 {
+		return errors.New("Asset type " + assetType.AssetType + " has no attributes " + strings.Join(unknown, ", "))
+	}
+	if len(missing) > 0 {
+		return errors.New("Asset type " + assetType.AssetType + " requires the attributes " + strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func getAssetType(stub shim.ChaincodeStubInterface, name string) (*AssetType, error) {
+	assetTypeAsByteArr, err := stub.GetState(assetTypeKey(name))
+	if err != nil {
+		return nil, err
+	}
+	if assetTypeAsByteArr == nil {
+		return nil, errors.New("Unknown asset type " + name + ", see getAssetTypes")
+	}
+	assetType := new(AssetType)
+	if err = json.Unmarshal(assetTypeAsByteArr, assetType); err != nil {
+		return nil, err
+	}
+	return assetType, nil
+}
+
+func putAssetType(stub shim.ChaincodeStubInterface, assetType *AssetType) error {
+	assetTypeAsByteArr, err := json.Marshal(assetType)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(assetTypeKey(assetType.AssetType), assetTypeAsByteArr)
+}
+
+func assetTypeKey(name string) string {
+	return "assetType/" + strings.ToUpper(name)
+}
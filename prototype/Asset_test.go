@@ -0,0 +1,223 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func (ledger *testLedger) escalator(escalatorID string) Asset {
+	result, err := ledger.query("getEscalator", escalatorID)
+	if err != nil {
+		ledger.t.Fatal(err)
+	}
+	var esc Asset
+	ledger.unmarshal(result, &esc)
+	return esc
+}
+
+func TestUpdateEscalator(t *testing.T) {
+	tests := []struct {
+		masterData string
+		valid      bool
+		want       MasterData // master data of DO0001 afterwards
+	}{
+		{`{"Manufacturer":"Thyssen","Model":"Velino","SerialNumber":"V-1234"}`, true,
+			MasterData{"Thyssen", "Velino", "V-1234", "", "", commissioningInService}},
+		{`{"InstallationDate":"2009-03-01","MaintenanceProvider":"Otis"}`, true,
+			MasterData{"Thyssen", "Velino", "V-1234", "2009-03-01", "Otis", commissioningInService}},
+		{`{"CommissioningStatus":"out_of_service"}`, true,
+			MasterData{"Thyssen", "Velino", "V-1234", "2009-03-01", "Otis", commissioningOutOfService}},
+		{`{"CommissioningStatus":"ABGEBAUT"}`, false,
+			MasterData{"Thyssen", "Velino", "V-1234", "2009-03-01", "Otis", commissioningOutOfService}},
+		{`{"InstallationDate":"01.03.2009"}`, false,
+			MasterData{"Thyssen", "Velino", "V-1234", "2009-03-01", "Otis", commissioningOutOfService}},
+		{`{"MaintenanceProvider":"Kone"}`, false,
+			MasterData{"Thyssen", "Velino", "V-1234", "2009-03-01", "Otis", commissioningOutOfService}},
+		{`Thyssen`, false,
+			MasterData{"Thyssen", "Velino", "V-1234", "2009-03-01", "Otis", commissioningOutOfService}},
+	}
+	ledger := newTestLedger(t, 1000)
+	for _, test := range tests {
+		if err := ledger.invoke("updateEscalator", "DO0001", test.masterData); (err == nil) != test.valid {
+			t.Errorf("updateEscalator(%s): err = %v", test.masterData, err)
+		}
+		esc := ledger.escalator("DO0001")
+		if esc.MasterData != test.want || esc.Trainstation != "Dortmund Hbf" {
+			t.Errorf("after updateEscalator(%s): %+v, want %+v", test.masterData, esc, test.want)
+		}
+	}
+	if err := ledger.invoke("updateEscalator", "XX0099", `{"Model":"Velino"}`); err == nil {
+		t.Error("updateEscalator of an unknown escalator was accepted")
+	}
+}
+
+func TestCreateEscalatorMasterData(t *testing.T) {
+	tests := []struct {
+		args   []string
+		valid  bool
+		status string
+	}{
+		{[]string{"DO", "4"}, true, commissioningInService},
+		{[]string{"DO", "4", `{"Model":"Velino","CommissioningStatus":"PLANNED"}`}, true,
+			commissioningPlanned},
+		{[]string{"DO", "4", `{"CommissioningStatus":"BESTELLT"}`}, false, ""},
+	}
+	for _, test := range tests {
+		ledger := newTestLedger(t, 1000)
+		if err := ledger.invoke("createEscalator", test.args...); (err == nil) != test.valid {
+			t.Errorf("createEscalator%q: err = %v", test.args, err)
+		}
+		if !test.valid {
+			if _, err := ledger.query("getEscalator", "DO0003"); err == nil {
+				t.Errorf("createEscalator%q stored an escalator", test.args)
+			}
+			continue
+		}
+		if esc := ledger.escalator("DO0003"); esc.CommissioningStatus != test.status || esc.Platform != "Gleis 4" {
+			t.Errorf("createEscalator%q: %+v", test.args, esc)
+		}
+	}
+}
+
+func TestDefineAssetType(t *testing.T) {
+	tests := []struct {
+		assetType string
+		valid     bool
+	}{
+		{`{"AssetType":"wc","Name":"Toilette","Attributes":[{"Name":"Cabins","Required":true}]}`, true},
+		{`{"AssetType":"ELEVATOR","Name":"Aufzug"}`, true},
+		{`{"AssetType":" ","Name":"Leer"}`, false},
+		{`{"AssetType":"WC/2","Name":"Toilette"}`, false},
+		{`{"AssetType":"WC","Attributes":[{"Name":"Cabins"},{"Name":"Cabins"}]}`, false},
+		{`{"AssetType":"WC","Attributes":[{"Description":"ohne Namen"}]}`, false},
+		{`WC`, false},
+	}
+	ledger := newTestLedger(t, 1000)
+	for _, test := range tests {
+		if err := ledger.invoke("defineAssetType", test.assetType); (err == nil) != test.valid {
+			t.Errorf("defineAssetType(%s): err = %v", test.assetType, err)
+		}
+	}
+
+	result, err := ledger.query("getAssetTypes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var assetTypes []AssetType
+	ledger.unmarshal(result, &assetTypes)
+	types := map[string]AssetType{}
+	for _, assetType := range assetTypes {
+		types[assetType.AssetType] = assetType
+	}
+	if len(assetTypes) != len(builtinAssetTypes)+1 || len(types["WC"].Attributes) != 1 ||
+		len(types["ELEVATOR"].Attributes) != 0 {
+		t.Errorf("getAssetTypes = %s", result)
+	}
+}
+
+func TestCreateAsset(t *testing.T) {
+	tests := []struct {
+		args       []string
+		valid      bool
+		attributes map[string]string // attributes of DO0003 afterwards
+	}{
+		{[]string{"ELEVATOR", "DO", "4", `{"Model":"Schindler 3300","Attributes":{"LoadCapacity":"1000"}}`}, true,
+			map[string]string{"LoadCapacity": "1000"}},
+		{[]string{"elevator", "Dortmund Hbf", "Gleis 4", `{"Attributes":{"LoadCapacity":"630","Stops":"3"}}`}, true,
+			map[string]string{"LoadCapacity": "630", "Stops": "3"}},
+		{[]string{"ESCALATOR", "DO", "4"}, true, nil},
+		{[]string{"ELEVATOR", "DO", "4"}, false, nil},
+		{[]string{"ELEVATOR", "DO", "4", `{"Attributes":{"LoadCapacity":"1000","Rise":"6"}}`}, false, nil},
+		{[]string{"MONORAIL", "DO", "4"}, false, nil},
+		{[]string{"ELEVATOR", "DO", "9", `{"Attributes":{"LoadCapacity":"1000"}}`}, false, nil},
+	}
+	for _, test := range tests {
+		ledger := newTestLedger(t, 1000)
+		if err := ledger.invoke("createAsset", test.args...); (err == nil) != test.valid {
+			t.Errorf("createAsset%q: err = %v", test.args, err)
+			continue
+		}
+		if !test.valid {
+			continue
+		}
+		asset := ledger.escalator("DO0003")
+		if asset.AssetType != strings.ToUpper(test.args[0]) || asset.StationID != "DO" || !asset.IsWorking ||
+			!reflect.DeepEqual(asset.Attributes, test.attributes) {
+			t.Errorf("createAsset%q: %+v", test.args, asset)
+		}
+	}
+}
+
+func TestUpdateAssetAttributes(t *testing.T) {
+	tests := []struct {
+		data       string
+		valid      bool
+		attributes map[string]string // attributes of DO0003 afterwards
+	}{
+		{`{"Attributes":{"Stops":"3"}}`, true, map[string]string{"LoadCapacity": "1000", "Stops": "3"}},
+		{`{"Attributes":{"Stops":""}}`, true, map[string]string{"LoadCapacity": "1000"}},
+		{`{"Attributes":{"LoadCapacity":""}}`, false, map[string]string{"LoadCapacity": "1000"}},
+		{`{"Attributes":{"DoorType":"sliding"}}`, false, map[string]string{"LoadCapacity": "1000"}},
+	}
+	ledger := newTestLedger(t, 1000)
+	ledger.mustInvoke("createAsset", "ELEVATOR", "DO", "4", `{"Attributes":{"LoadCapacity":"1000"}}`)
+	for _, test := range tests {
+		if err := ledger.invoke("updateAsset", "DO0003", test.data); (err == nil) != test.valid {
+			t.Errorf("updateAsset(%s): err = %v", test.data, err)
+		}
+		if asset := ledger.escalator("DO0003"); !reflect.DeepEqual(asset.Attributes, test.attributes) {
+			t.Errorf("after updateAsset(%s): attributes %v, want %v", test.data, asset.Attributes, test.attributes)
+		}
+	}
+}
+
+func TestErrorCatalogue(t *testing.T) {
+	tests := []struct {
+		device  string
+		errorID string
+		valid   bool
+	}{
+		{"DO0003", "EL-DOOR", true},
+		{"DO0003", "#2356-102", false},
+		{"DO0001", "#2356-102", true}, // catalogued for escalators
+		{"DO0001", "EL-DOOR", false},
+		{"DO0099", "EL-DOOR", false}, // not registered
+	}
+	for _, test := range tests {
+		ledger := newTestLedger(t, 1000)
+		ledger.mustInvoke("createAsset", "ELEVATOR", "DO", "4", `{"Attributes":{"LoadCapacity":"1000"}}`)
+		err := ledger.invoke("createTicket", "DO", "4", test.device, "Tuer", test.errorID, "Tuer oeffnet nicht")
+		if (err == nil) != test.valid {
+			t.Errorf("createTicket for %s with %s: err = %v", test.device, test.errorID, err)
+		}
+	}
+}
+
+func TestGetAssets(t *testing.T) {
+	ledger := newTestLedger(t, 1000)
+	ledger.mustInvoke("createAsset", "TICKET_MACHINE", "BR", "1")
+	tests := []struct {
+		args []string
+		want []string // AssetIDs
+	}{
+		{nil, []string{"BR0002", "BR0003", "DO0001"}},
+		{[]string{"ticket_machine"}, []string{"BR0003"}},
+		{[]string{"ELEVATOR"}, nil},
+	}
+	for _, test := range tests {
+		result, err := ledger.query("getAssets", test.args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var assets []Asset
+		ledger.unmarshal(result, &assets)
+		var ids []string
+		for _, asset := range assets {
+			ids = append(ids, asset.AssetID)
+		}
+		if !reflect.DeepEqual(ids, test.want) {
+			t.Errorf("getAssets%q = %v, want %v", test.args, ids, test.want)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+// Asset availability statistics
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// A StateChange records that an asset started or stopped working. The log of an asset is append-only and ordered by
+// Seq.
+type StateChange struct {
+	AssetID        string
+	Seq            int64
+	IsWorking      bool   // for a decommissioning the state the asset was retired in, it does not change it
+	Decommissioned bool   // the asset was retired, it is not observed any more from Time on
+	Action         string // the function that changed the asset
+	Time           int64
+}
+
+// AvailabilityStats summarise the state log of one or more assets over the range From to To.
+type AvailabilityStats struct {
+	Scope        string // AssetID, StationID or ServiceProvider the statistics are computed for
+	From         int64
+	To           int64
+	Assets       int
+	Observed     int64   // seconds the assets were in operation within the range, summed over all assets
+	Uptime       int64   // seconds of Observed the assets were working
+	Availability float64 // Uptime in percent of Observed
+	Failures     int64   // changes from working to broken within the range
+	Repairs      int64   // changes from broken to working within the range
+	MTBF         int64   // mean time between failures: Uptime / Failures, in seconds
+	MTTR         int64   // mean time to repair: mean duration of the outages ended by the Repairs, in seconds
+	repairTime   int64   // summed duration of the outages ended by the Repairs
+}
+
+// returns the availability statistics of one asset. Arguments are the AssetID and the range, from and to, as Unix
+// seconds or dates YYYY-MM-DD (midnight UTC).
+func (t *SimpleChaincode) getAssetAvailability(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 3 {
+		return nil, errors.New("Wrong number of arguments, must be 3: AssetID, from and to")
+	}
+	from, to, err := parseTimeRange(args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	esc, err := getAsset(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	stats := AvailabilityStats{Scope: esc.AssetID, From: from, To: to}
+	if err = stats.add(stub, esc); err != nil {
+		return nil, err
+	}
+	stats.finish()
+	return json.Marshal(stats)
+}
+
+// returns the availability statistics of all assets of a station. Arguments are the StationID (or name of the
+// station) and the range, see getAssetAvailability.
+func (t *SimpleChaincode) getStationAvailability(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 3 {
+		return nil, errors.New("Wrong number of arguments, must be 3: StationID, from and to")
+	}
+	from, to, err := parseTimeRange(args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	station, err := resolveStation(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	return availabilityOf(stub, station.StationID, from, to, func(esc *Asset) bool {
+		return esc.StationID == station.StationID
+	})
+}
+
+// returns the availability statistics of all assets a ServiceProvider is contracted to maintain (see
+// Asset.MaintenanceProvider). Arguments are the ServiceProvider and the range, see getAssetAvailability.
+func (t *SimpleChaincode) getProviderAvailability(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 3 {
+		return nil, errors.New("Wrong number of arguments, must be 3: ServiceProvider, from and to")
+	}
+	from, to, err := parseTimeRange(args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	return availabilityOf(stub, args[0], from, to, func(esc *Asset) bool {
+		return strings.EqualFold(esc.MaintenanceProvider, args[0])
+	})
+}
+
+// availabilityOf sums up the statistics of all assets selected by include.
+func availabilityOf(stub shim.ChaincodeStubInterface, scope string, from int64, to int64, include func(*Asset) bool) ([]byte, error) {
+	stats := AvailabilityStats{Scope: scope, From: from, To: to}
+	err := forEachInRange(stub, assetPrefix, assetPrefix+"~", func(escAsByteArr []byte) error {
+		var esc Asset
+		if err := json.Unmarshal(escAsByteArr, &esc); err != nil {
+			return err
+		}
+		if !include(&esc) {
+			return nil
+		}
+		return stats.add(stub, &esc)
+	})
+	if err != nil {
+		return nil, err
+	}
+	stats.finish()
+	return json.Marshal(stats)
+}
+
+// add replays the state log of the asset and adds its times within the range to the statistics.
+func (stats *AvailabilityStats) add(stub shim.ChaincodeStubInterface, esc *Asset) error {
+	changes, err := getStateChanges(stub, esc.AssetID)
+	if err != nil {
+		return err
+	}
+	stats.Assets++
+
+	// assets without log were created before it was kept, they are taken to be in the current state all along
+	working, inService := esc.IsWorking, !esc.isDecommissioned()
+	if len(changes) > 0 {
+		created := changes[0].Action == "createAsset" || changes[0].Action == "createEscalator"
+		working, inService = !changes[0].IsWorking, !created
+		if changes[0].Decommissioned {
+			working, inService = changes[0].IsWorking, true
+		}
+	}
+	since := stats.From
+	var brokenSince int64
+	for _, change := range changes {
+		if change.Time > stats.To {
+			break
+		}
+		if inService {
+			stats.observe(since, change.Time, working)
+		}
+		if change.Time >= stats.From {
+			if working && !change.IsWorking && !change.Decommissioned {
+				stats.Failures++
+			}
+			if !working && change.IsWorking && brokenSince != 0 {
+				stats.Repairs++
+				stats.repairTime += change.Time - brokenSince
+			}
+		}
+		if working && !change.IsWorking {
+			brokenSince = change.Time
+		}
+		working, inService, since = change.IsWorking, !change.Decommissioned, change.Time
+	}
+	if inService {
+		stats.observe(since, stats.To, working)
+	}
+	return nil
+}
+
+// observe counts the interval from start to end, clipped to the range, as up- or downtime.
+func (stats *AvailabilityStats) observe(start int64, end int64, working bool) {
+	if start < stats.From {
+		start = stats.From
+	}
+	if end > stats.To {
+		end = stats.To
+	}
+	if end <= start {
+		return
+	}
+	stats.Observed += end - start
+	if working {
+		stats.Uptime += end - start
+	}
+}
+
+func (stats *AvailabilityStats) finish() {
+	if stats.Observed > 0 {
+		stats.Availability = float64(stats.Uptime*10000/stats.Observed) / 100
+	}
+	if stats.Failures > 0 {
+		stats.MTBF = stats.Uptime / stats.Failures
+	}
+	if stats.Repairs > 0 {
+		stats.MTTR = stats.repairTime / stats.Repairs
+	}
+}
+
+// recordStateChange appends the current state of the asset to its state log.
+func recordStateChange(stub shim.ChaincodeStubInterface, esc *Asset, action string) error {
+	seq, err := nextSequence(stub, counterKey("stateChange/"+esc.AssetID))
+	if err != nil {
+		return err
+	}
+	change := StateChange{
+		AssetID:        esc.AssetID,
+		Seq:            seq,
+		IsWorking:      esc.IsWorking,
+		Decommissioned: esc.isDecommissioned(),
+		Action:         action,
+		Time:           getTransactionTime(stub),
+	}
+	changeAsByteArr, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(stateChangeKey(esc.AssetID, seq), changeAsByteArr)
+}
+
+// returns the state log of an asset. Input is the AssetID.
+func (t *SimpleChaincode) getStateChanges(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Wrong number of arguments, must be 1: AssetID")
+	}
+	return getRangeAsJSONArray(stub, stateChangePrefix(args[0]), stateChangePrefix(args[0])+"~")
+}
+
+func getStateChanges(stub shim.ChaincodeStubInterface, assetID string) ([]StateChange, error) {
+	var changes []StateChange
+	err := forEachInRange(stub, stateChangePrefix(assetID), stateChangePrefix(assetID)+"~", func(changeAsByteArr []byte) error {
+		var change StateChange
+		if err := json.Unmarshal(changeAsByteArr, &change); err != nil {
+			return err
+		}
+		changes = append(changes, change)
+		return nil
+	})
+	return changes, err
+}
+
+// parseTimeRange parses the bounds of a statistics range, each given as Unix seconds or date YYYY-MM-DD.
+func parseTimeRange(from string, to string) (int64, int64, error) {
+	start, err := parseTime(from)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseTime(to)
+	if err != nil {
+		return 0, 0, err
+	}
+	if end <= start {
+		return 0, 0, errors.New("End of the range must be after its start")
+	}
+	return start, end, nil
+}
+
+func parseTime(s string) (int64, error) {
+	if seconds, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return seconds, nil
+	}
+	date, err := time.Parse(installationDateLayout, s)
+	if err != nil {
+		return 0, errors.New(s + " is neither Unix seconds nor a date of the form YYYY-MM-DD")
+	}
+	return date.Unix(), nil
+}
+
+func stateChangePrefix(assetID string) string {
+	return "stateChange/" + assetID + "/"
+}
+
+func stateChangeKey(assetID string, seq int64) string {
+	return stateChangePrefix(assetID) + leftPad2Len(strconv.FormatInt(seq, 10), "0", 8)
+}
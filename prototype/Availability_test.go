@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAvailabilityStatsAdd(t *testing.T) {
+	tests := []struct {
+		name     string
+		asset    Asset // state of the escalator at the end of its log
+		changes  []StateChange
+		observed int64
+		uptime   int64
+		failures int64
+		repairs  int64
+		mttr     int64
+	}{
+		{
+			name:     "working escalator without log",
+			asset:    Asset{IsWorking: true},
+			observed: 1000, uptime: 1000,
+		},
+		{
+			name:     "broken escalator without log",
+			asset:    Asset{},
+			observed: 1000,
+		},
+		{
+			name:  "decommissioned escalator without log",
+			asset: Asset{MasterData: MasterData{CommissioningStatus: commissioningDecommissioned}},
+		},
+		{
+			name:  "created within the range, failed and repaired",
+			asset: Asset{IsWorking: true},
+			changes: []StateChange{
+				{IsWorking: true, Action: "createEscalator", Time: 1200},
+				{IsWorking: false, Action: "setEscalatorState", Time: 1400},
+				{IsWorking: true, Action: "setEscalatorState", Time: 1500},
+			},
+			observed: 800, uptime: 700, failures: 1, repairs: 1, mttr: 100,
+		},
+		{
+			name:  "failed before the range",
+			asset: Asset{IsWorking: true},
+			changes: []StateChange{
+				{IsWorking: false, Action: "setEscalatorState", Time: 500},
+				{IsWorking: true, Action: "setEscalatorState", Time: 1500},
+			},
+			observed: 1000, uptime: 500, repairs: 1, mttr: 1000,
+		},
+		{
+			name:  "changes after the range only",
+			asset: Asset{},
+			changes: []StateChange{
+				{IsWorking: false, Action: "setEscalatorState", Time: 2500},
+			},
+			observed: 1000, uptime: 1000,
+		},
+		{
+			name:  "decommissioned while working, log starts with the decommissioning",
+			asset: Asset{IsWorking: false, MasterData: MasterData{CommissioningStatus: commissioningDecommissioned}},
+			changes: []StateChange{
+				{IsWorking: true, Decommissioned: true, Action: "decommissionEscalator", Time: 1500},
+			},
+			observed: 500, uptime: 500,
+		},
+		{
+			name:  "decommissioned while broken, log starts with the decommissioning",
+			asset: Asset{IsWorking: false, MasterData: MasterData{CommissioningStatus: commissioningDecommissioned}},
+			changes: []StateChange{
+				{IsWorking: false, Decommissioned: true, Action: "decommissionEscalator", Time: 1500},
+			},
+			observed: 500,
+		},
+	}
+	for _, test := range tests {
+		stub := newTestStub(3000)
+		test.asset.AssetID = "DO0001"
+		for i, change := range test.changes {
+			change.AssetID, change.Seq = test.asset.AssetID, int64(i+1)
+			changeAsByteArr, _ := json.Marshal(change)
+			stub.state[stateChangeKey(change.AssetID, change.Seq)] = changeAsByteArr
+		}
+		stub.commit()
+		stats := AvailabilityStats{From: 1000, To: 2000}
+		if err := stats.add(stub, &test.asset); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		stats.finish()
+		if stats.Assets != 1 || stats.Observed != test.observed || stats.Uptime != test.uptime ||
+			stats.Failures != test.failures || stats.Repairs != test.repairs || stats.MTTR != test.mttr {
+			t.Errorf("%s: got %+v", test.name, stats)
+		}
+	}
+}
+
+func TestAvailabilityQueries(t *testing.T) {
+	// DO0001 fails at 2000 and works again at 3000, BR0002 fails at 4000 and is still broken at the end of the range
+	ledger := newTestLedger(t, 1000)
+	ledger.mustInvoke("updateEscalator", "BR0002", `{"MaintenanceProvider":"Otis"}`)
+	ledger.stub.time = 2000
+	ledger.mustInvoke("setEscalatorState", "DO0001", "false", "Motor", "#2356-102", "Totalausfall")
+	ledger.stub.time = 3000
+	ledger.mustInvoke("cancelTicket", "0001", "FALSE_ALARM")
+	ledger.stub.time = 4000
+	ledger.mustInvoke("setEscalatorState", "BR0002", "false", "Handlauf", "#2356-102", "Handlauf steht")
+
+	tests := []struct {
+		function string
+		args     []string
+		valid    bool
+		want     AvailabilityStats
+	}{
+		{"getEscalatorAvailability", []string{"DO0001", "1000", "5000"}, true,
+			AvailabilityStats{Assets: 1, Observed: 4000, Uptime: 3000, Availability: 75, Failures: 1, Repairs: 1,
+				MTBF: 3000, MTTR: 1000}},
+		{"getEscalatorAvailability", []string{"DO0001", "2500", "5000"}, true,
+			AvailabilityStats{Assets: 1, Observed: 2500, Uptime: 2000, Availability: 80, Repairs: 1, MTTR: 1000}},
+		{"getStationAvailability", []string{"BR", "1000", "5000"}, true,
+			AvailabilityStats{Assets: 1, Observed: 4000, Uptime: 3000, Availability: 75, Failures: 1, MTBF: 3000}},
+		{"getProviderAvailability", []string{"otis", "1000", "5000"}, true,
+			AvailabilityStats{Assets: 1, Observed: 4000, Uptime: 3000, Availability: 75, Failures: 1, MTBF: 3000}},
+		{"getProviderAvailability", []string{"Schindler", "1000", "5000"}, true, AvailabilityStats{}},
+		{"getEscalatorAvailability", []string{"XX0099", "1000", "5000"}, false, AvailabilityStats{}},
+		{"getStationAvailability", []string{"MS", "1000", "5000"}, false, AvailabilityStats{}},
+		{"getEscalatorAvailability", []string{"DO0001", "5000", "1000"}, false, AvailabilityStats{}},
+		{"getEscalatorAvailability", []string{"DO0001", "gestern", "5000"}, false, AvailabilityStats{}},
+	}
+	for _, test := range tests {
+		result, err := ledger.query(test.function, test.args...)
+		if (err == nil) != test.valid {
+			t.Errorf("%s%q: err = %v", test.function, test.args, err)
+			continue
+		}
+		if !test.valid {
+			continue
+		}
+		var stats AvailabilityStats
+		ledger.unmarshal(result, &stats)
+		test.want.Scope, stats.Scope = "", ""
+		test.want.From, test.want.To = stats.From, stats.To
+		if stats != test.want {
+			t.Errorf("%s%q = %+v, want %+v", test.function, test.args, stats, test.want)
+		}
+	}
+
+	result, err := ledger.query("getStateChanges", "DO0001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var changes []StateChange
+	ledger.unmarshal(result, &changes)
+	if len(changes) != 3 || changes[0].Action != "createAsset" || changes[1].IsWorking || !changes[2].IsWorking ||
+		changes[2].Time != 3000 {
+		t.Errorf("getStateChanges(DO0001) = %+v", changes)
+	}
+}
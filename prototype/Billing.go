@@ -0,0 +1,408 @@
+// Billing of repairs and SLA penalties
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// A PriceSchedule holds the prices agreed with a service provider. All amounts are in cent.
+type PriceSchedule struct {
+	ServiceProvider string
+	CallOutFee      int64            // flat fee per repair
+	LabourRate      int64            // per hour and mechanic
+	PartPrices      map[string]int64 // per PartNumber, parts without price are charged with 0
+	LightPenalty    int64            // deducted for a light violation of the SLA
+	SeverePenalty   int64            // deducted for a severe violation of the SLA
+}
+
+// A Charge is a single billable amount of a ticket: the costs of a repair, or a penalty for violating the SLA, which
+// has a negative Amount. Charges are collected into billing documents by issueBillingDocuments.
+type Charge struct {
+	ChargeID        string
+	Kind            string // "REPAIR" or "PENALTY"
+	TicketID        string
+	ServiceProvider string
+	Labour          int64
+	Parts           int64
+	CallOutFee      int64
+	Penalty         int64
+	Amount          int64
+	Time            int64
+	DocumentID      string // billing document the charge was issued with, empty until then
+}
+
+// A BillingDocument is an invoice over the repair charges or a credit note over the penalties of one provider and period.
+type BillingDocument struct {
+	DocumentID      string
+	Kind            string // "INVOICE" or "CREDIT_NOTE"
+	ServiceProvider string
+	PeriodStart     int64
+	PeriodEnd       int64
+	ChargeIDs       []string
+	Amount          int64 // positive for invoices, negative for credit notes
+	Status          string
+	IssuedAt        int64
+	SettledAt       int64
+}
+
+// BillingBalance sums up the billing documents and unbilled charges of a provider.
+type BillingBalance struct {
+	ServiceProvider    string
+	Unbilled           int64
+	OpenInvoices       int64
+	OpenCreditNotes    int64
+	SettledInvoices    int64
+	SettledCreditNotes int64
+}
+
+const (
+	chargeRepair  = "REPAIR"
+	chargePenalty = "PENALTY"
+
+	documentInvoice    = "INVOICE"
+	documentCreditNote = "CREDIT_NOTE"
+
+	documentOpen    = "OPEN"
+	documentSettled = "SETTLED"
+)
+
+// Set the prices agreed with a service provider. Arguments are the ServiceProvider and the PriceSchedule as JSON, e.g.
+// {"CallOutFee":9500,"LabourRate":7800,"PartPrices":{"RTM-X 64":125000},"LightPenalty":5000,"SeverePenalty":25000}
+func (t *SimpleChaincode) setPriceSchedule(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 2 {
+		return nil, errors.New("Wrong number of arguments, must be 2: ServiceProvider and PriceSchedule as JSON")
+	}
+	var schedule PriceSchedule
+	if err := json.Unmarshal([]byte(args[1]), &schedule); err != nil {
+		return nil, errors.New("The price schedule must be a JSON encoded PriceSchedule: " + err.Error())
+	}
+	schedule.ServiceProvider = args[0]
+	if schedule.CallOutFee < 0 || schedule.LabourRate < 0 || schedule.LightPenalty < 0 || schedule.SeverePenalty < 0 {
+		return nil, errors.New("Prices and penalties must not be negative")
+	}
+	for partNumber, price := range schedule.PartPrices {
+		if price < 0 {
+			return nil, errors.New("Price of part " + partNumber + " must not be negative")
+		}
+	}
+	scheduleAsByteArr, err := json.Marshal(schedule)
+	if err != nil {
+		return nil, err
+	}
+	return nil, stub.PutState(priceScheduleKey(args[0]), scheduleAsByteArr)
+}
+
+// Issue the billing documents of a service provider for a period. Arguments are the ServiceProvider and start and end
+// of the period in seconds since the epoch, end excluded. All unbilled repair charges of the period are collected into
+// an invoice, all unbilled penalties into a credit note. Returns the issued documents.
+func (t *SimpleChaincode) issueBillingDocuments(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 3 {
+		return nil, errors.New("Wrong number of arguments, must be 3: ServiceProvider, start and end of the period")
+	}
+	periodStart, err1 := strconv.ParseInt(args[1], 10, 64)
+	periodEnd, err2 := strconv.ParseInt(args[2], 10, 64)
+	if err1 != nil || err2 != nil || periodEnd <= periodStart {
+		return nil, errors.New("Start and end of the period must be seconds since the epoch, with start before end")
+	}
+
+	charges, err := getCharges(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	now := getTransactionTime(stub)
+	invoice := &BillingDocument{Kind: documentInvoice, ChargeIDs: []string{}}
+	creditNote := &BillingDocument{Kind: documentCreditNote, ChargeIDs: []string{}}
+	var billed []*Charge
+	for i := range charges {
+		charge := &charges[i]
+		if charge.DocumentID != "" || !strings.EqualFold(charge.ServiceProvider, args[0]) ||
+			charge.Time < periodStart || charge.Time >= periodEnd {
+			continue
+		}
+		document := invoice
+		if charge.Kind == chargePenalty {
+			document = creditNote
+		}
+		document.ChargeIDs = append(document.ChargeIDs, charge.ChargeID)
+		document.Amount += charge.Amount
+		billed = append(billed, charge)
+	}
+
+	issued := []*BillingDocument{}
+	for _, document := range []*BillingDocument{invoice, creditNote} {
+		if len(document.ChargeIDs) == 0 {
+			continue
+		}
+		seq, err := nextSequence(stub, counterKey("billingDocument"))
+		if err != nil {
+			return nil, err
+		}
+		document.DocumentID = leftPad2Len(strconv.FormatInt(seq, 10), "0", 8)
+		document.ServiceProvider = args[0]
+		document.PeriodStart = periodStart
+		document.PeriodEnd = periodEnd
+		document.Status = documentOpen
+		document.IssuedAt = now
+		if err = putBillingDocument(stub, document); err != nil {
+			return nil, err
+		}
+		issued = append(issued, document)
+	}
+	for _, charge := range billed {
+		charge.DocumentID = invoice.DocumentID
+		if charge.Kind == chargePenalty {
+			charge.DocumentID = creditNote.DocumentID
+		}
+		if err = putCharge(stub, charge); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(issued)
+}
+
+// Mark a billing document as paid. Input is the DocumentID.
+func (t *SimpleChaincode) settleBillingDocument(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Wrong number of arguments, must be 1: DocumentID")
+	}
+	documentAsByteArr, err := stub.GetState(billingDocumentKey(args[0]))
+	if err != nil {
+		return nil, err
+	}
+	if documentAsByteArr == nil {
+		return nil, errors.New("No billing document found for DocumentID " + args[0])
+	}
+	var document BillingDocument
+	if err = json.Unmarshal(documentAsByteArr, &document); err != nil {
+		return nil, err
+	}
+	if document.Status == documentSettled {
+		return nil, errors.New("Billing document " + document.DocumentID + " is already settled")
+	}
+	document.Status = documentSettled
+	document.SettledAt = getTransactionTime(stub)
+	return nil, putBillingDocument(stub, &document)
+}
+
+// returns the price schedule of a service provider. Input is the ServiceProvider.
+func (t *SimpleChaincode) getPriceSchedule(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Wrong number of arguments, must be 1: ServiceProvider")
+	}
+	return stub.GetState(priceScheduleKey(args[0]))
+}
+
+// returns the charges of a ticket. Input is the TicketID.
+func (t *SimpleChaincode) getTicketCharges(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Wrong number of arguments, must be 1: TicketID")
+	}
+	charges, err := getCharges(stub)
+	if err != nil {
+		return nil, err
+	}
+	result := []Charge{}
+	for _, charge := range charges {
+		if charge.TicketID == args[0] {
+			result = append(result, charge)
+		}
+	}
+	return json.Marshal(result)
+}
+
+// returns the billing documents of a service provider. Optionally takes "OPEN" or "SETTLED" as second argument.
+func (t *SimpleChaincode) getBillingDocuments(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, errors.New("Wrong number of arguments, must be 1 or 2: ServiceProvider and optionally OPEN or SETTLED")
+	}
+	documents, err := getBillingDocuments(stub)
+	if err != nil {
+		return nil, err
+	}
+	result := []BillingDocument{}
+	for _, document := range documents {
+		if !strings.EqualFold(document.ServiceProvider, args[0]) {
+			continue
+		}
+		if len(args) == 2 && !strings.EqualFold(document.Status, args[1]) {
+			continue
+		}
+		result = append(result, document)
+	}
+	return json.Marshal(result)
+}
+
+// returns the open and settled amounts of a service provider. Input is the ServiceProvider.
+func (t *SimpleChaincode) getBillingBalance(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Wrong number of arguments, must be 1: ServiceProvider")
+	}
+	balance := BillingBalance{ServiceProvider: args[0]}
+
+	charges, err := getCharges(stub)
+	if err != nil {
+		return nil, err
+	}
+	for _, charge := range charges {
+		if charge.DocumentID == "" && strings.EqualFold(charge.ServiceProvider, args[0]) {
+			balance.Unbilled += charge.Amount
+		}
+	}
+
+	documents, err := getBillingDocuments(stub)
+	if err != nil {
+		return nil, err
+	}
+	for _, document := range documents {
+		if !strings.EqualFold(document.ServiceProvider, args[0]) {
+			continue
+		}
+		switch {
+		case document.Kind == documentInvoice && document.Status == documentOpen:
+			balance.OpenInvoices += document.Amount
+		case document.Kind == documentInvoice:
+			balance.SettledInvoices += document.Amount
+		case document.Status == documentOpen:
+			balance.OpenCreditNotes += document.Amount
+		default:
+			balance.SettledCreditNotes += document.Amount
+		}
+	}
+	return json.Marshal(balance)
+}
+
+// chargeRepairCosts books the costs of a finished repair for the provider that did it. Providers without price schedule
+// are not billed through the ledger.
+func chargeRepairCosts(stub shim.ChaincodeStubInterface, ticket *Ticket) error {
+	schedule, err := getPriceScheduleStruct(stub, ticket.ServiceProvider)
+	if err != nil || schedule == nil {
+		return err
+	}
+	charge := &Charge{
+		Kind:            chargeRepair,
+		TicketID:        ticket.TicketID,
+		ServiceProvider: ticket.ServiceProvider,
+		CallOutFee:      schedule.CallOutFee,
+	}
+	if ticket.Report != nil {
+		var hours float64
+		for _, labour := range ticket.Report.Labour {
+			hours += labour.Hours
+		}
+		charge.Labour = int64(math.Floor(hours*float64(schedule.LabourRate) + 0.5))
+		for _, part := range ticket.Report.PartsReplaced {
+			charge.Parts += part.Quantity * schedule.PartPrices[part.PartNumber]
+		}
+	}
+	charge.Amount = charge.Labour + charge.Parts + charge.CallOutFee
+	return addCharge(stub, charge)
+}
+
+// chargeSLAPenalty books the penalty for the SLA result of a ticket against the provider it is scored against.
+func chargeSLAPenalty(stub shim.ChaincodeStubInterface, ticket *Ticket, slaResult string) error {
+	provider := ticket.scoredProvider()
+	schedule, err := getPriceScheduleStruct(stub, provider)
+	if err != nil || schedule == nil {
+		return err
+	}
+	charge := &Charge{
+		Kind:            chargePenalty,
+		TicketID:        ticket.TicketID,
+		ServiceProvider: provider,
+	}
+	switch slaResult {
+	case slaLight:
+		charge.Penalty = schedule.LightPenalty
+	case slaSevere:
+		charge.Penalty = schedule.SeverePenalty
+	}
+	if charge.Penalty == 0 {
+		return nil
+	}
+	charge.Amount = -charge.Penalty
+	return addCharge(stub, charge)
+}
+
+func addCharge(stub shim.ChaincodeStubInterface, charge *Charge) error {
+	seq, err := nextSequence(stub, counterKey("charge"))
+	if err != nil {
+		return err
+	}
+	charge.ChargeID = leftPad2Len(strconv.FormatInt(seq, 10), "0", 8)
+	charge.Time = getTransactionTime(stub)
+	return putCharge(stub, charge)
+}
+
+func putCharge(stub shim.ChaincodeStubInterface, charge *Charge) error {
+	chargeAsByteArr, err := json.Marshal(charge)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(chargeKey(charge.ChargeID), chargeAsByteArr)
+}
+
+func putBillingDocument(stub shim.ChaincodeStubInterface, document *BillingDocument) error {
+	documentAsByteArr, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(billingDocumentKey(document.DocumentID), documentAsByteArr)
+}
+
+// getPriceScheduleStruct returns the price schedule of a provider, or nil if there is none.
+func getPriceScheduleStruct(stub shim.ChaincodeStubInterface, serviceProvider string) (*PriceSchedule, error) {
+	scheduleAsByteArr, err := stub.GetState(priceScheduleKey(serviceProvider))
+	if err != nil || scheduleAsByteArr == nil {
+		return nil, err
+	}
+	schedule := new(PriceSchedule)
+	if err = json.Unmarshal(scheduleAsByteArr, schedule); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+func getCharges(stub shim.ChaincodeStubInterface) ([]Charge, error) {
+	var charges []Charge
+	err := forEachInRange(stub, chargeKey(""), chargeKey("~"), func(value []byte) error {
+		var charge Charge
+		if err := json.Unmarshal(value, &charge); err != nil {
+			return err
+		}
+		charges = append(charges, charge)
+		return nil
+	})
+	return charges, err
+}
+
+func getBillingDocuments(stub shim.ChaincodeStubInterface) ([]BillingDocument, error) {
+	var documents []BillingDocument
+	err := forEachInRange(stub, billingDocumentKey(""), billingDocumentKey("~"), func(value []byte) error {
+		var document BillingDocument
+		if err := json.Unmarshal(value, &document); err != nil {
+			return err
+		}
+		documents = append(documents, document)
+		return nil
+	})
+	return documents, err
+}
+
+func priceScheduleKey(serviceProvider string) string {
+	return "priceSchedule/" + strings.ToLower(serviceProvider)
+}
+
+func chargeKey(chargeID string) string {
+	return "charge/" + chargeID
+}
+
+func billingDocumentKey(documentID string) string {
+	return "billingDocument/" + documentID
+}
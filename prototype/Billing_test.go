@@ -0,0 +1,201 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+const thyssenPrices = `{"CallOutFee":9500,"LabourRate":7800,"PartPrices":{"RTM-X 64":125000},"LightPenalty":5000,"SeverePenalty":25000}`
+
+func (ledger *testLedger) ticketCharges(ticketID string) []Charge {
+	result, err := ledger.query("getTicketCharges", ticketID)
+	if err != nil {
+		ledger.t.Fatal(err)
+	}
+	var charges []Charge
+	ledger.unmarshal(result, &charges)
+	return charges
+}
+
+func (ledger *testLedger) billingBalance(serviceProvider string) BillingBalance {
+	result, err := ledger.query("getBillingBalance", serviceProvider)
+	if err != nil {
+		ledger.t.Fatal(err)
+	}
+	var balance BillingBalance
+	ledger.unmarshal(result, &balance)
+	return balance
+}
+
+func TestSetPriceSchedule(t *testing.T) {
+	tests := []struct {
+		args  []string
+		valid bool
+	}{
+		{[]string{"Thyssen", thyssenPrices}, true},
+		{[]string{"Otis", `{}`}, true},
+		{[]string{"Otis", `{"CallOutFee":-1}`}, false},
+		{[]string{"Otis", `{"SeverePenalty":-1}`}, false},
+		{[]string{"Otis", `{"PartPrices":{"RTM-X 64":-1}}`}, false},
+		{[]string{"Otis", "9500"}, false},
+		{[]string{"Otis"}, false},
+	}
+	ledger := newTestLedger(t, 1000)
+	for _, test := range tests {
+		if err := ledger.invoke("setPriceSchedule", test.args...); (err == nil) != test.valid {
+			t.Errorf("setPriceSchedule%q: err = %v", test.args, err)
+		}
+	}
+
+	result, err := ledger.query("getPriceSchedule", "THYSSEN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schedule PriceSchedule
+	ledger.unmarshal(result, &schedule)
+	if schedule.ServiceProvider != "Thyssen" || schedule.LabourRate != 7800 || schedule.PartPrices["RTM-X 64"] != 125000 {
+		t.Errorf("getPriceSchedule(THYSSEN) = %s", result)
+	}
+}
+
+func TestTicketCharges(t *testing.T) {
+	report := `{"RootCause":"WEAR","PartsReplaced":[{"PartNumber":"RTM-X 64","Quantity":1,"Depot":"Dortmund"}],
+		"Labour":[{"Mechanic":"Hans","Hours":1.25},{"Mechanic":"Jan","Hours":0.33}]}`
+	repair := Charge{Kind: chargeRepair, ServiceProvider: "Thyssen", Labour: 12324, Parts: 125000, CallOutFee: 9500,
+		Amount: 146824}
+	tests := []struct {
+		name     string
+		provider string
+		arrival  int64 // seconds after the ticket creation, the agreed time is 7200s
+		want     []Charge
+	}{
+		{"in time", "Thyssen", 3600, []Charge{repair}},
+		{"light violation", "Thyssen", 10000, []Charge{repair,
+			{Kind: chargePenalty, ServiceProvider: "Thyssen", Penalty: 5000, Amount: -5000}}},
+		{"severe violation", "Thyssen", 20000, []Charge{repair,
+			{Kind: chargePenalty, ServiceProvider: "Thyssen", Penalty: 25000, Amount: -25000}}},
+		{"no price schedule", "Otis", 20000, []Charge{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ledger := newTestLedger(t, 1000)
+			ledger.mustInvoke("setPriceSchedule", "Thyssen", thyssenPrices)
+			ledger.mustInvoke("receiveParts", test.provider, "Dortmund", "RTM-X 64", "1")
+			ledger.reportFailure("DO0001")
+			ledger.mustInvoke("assignTicket", "0001", test.provider)
+			ledger.advanceTicket("0001", stateOnTheWay)
+			ledger.stub.time = 1000 + test.arrival
+			ledger.advanceTicket("0001", stateRepairing)
+			ledger.mustInvoke("writeFinalReport", "0001", report)
+			ledger.advanceTicket("0001", stateDone)
+
+			charges := ledger.ticketCharges("0001")
+			for i := range charges {
+				if charges[i].TicketID != "0001" || charges[i].Time != ledger.stub.time || charges[i].DocumentID != "" {
+					t.Errorf("charge %+v", charges[i])
+				}
+				charges[i].ChargeID, charges[i].TicketID, charges[i].Time = "", "", 0
+			}
+			if !reflect.DeepEqual(charges, test.want) {
+				t.Errorf("charges = %+v, want %+v", charges, test.want)
+			}
+		})
+	}
+}
+
+func TestRepeatFailurePenalty(t *testing.T) {
+	tests := []struct {
+		name      string
+		arrival   int64   // seconds after the creation of the first ticket
+		penalties []int64 // penalties charged for the first ticket
+	}{
+		{"repair in time", 3600, []int64{5000}},
+		{"repair already late", 10000, []int64{5000}},
+		{"repair severely late", 20000, []int64{25000}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ledger := newTestLedger(t, 1000)
+			ledger.mustInvoke("setPriceSchedule", "Thyssen", thyssenPrices)
+			ledger.reportFailure("DO0001")
+			ledger.advanceTicket("0001", stateOnTheWay)
+			ledger.stub.time = 1000 + test.arrival
+			ledger.advanceTicket("0001", stateDone)
+
+			// the escalator fails again within the warranty window
+			ledger.stub.time += 3600
+			ledger.reportFailure("DO0001")
+			ledger.advanceTicket("0002", stateDone)
+
+			penalties := []int64{}
+			for _, charge := range ledger.ticketCharges("0001") {
+				if charge.Kind == chargePenalty {
+					penalties = append(penalties, charge.Penalty)
+				}
+			}
+			if !reflect.DeepEqual(penalties, test.penalties) {
+				t.Errorf("penalties = %v, want %v", penalties, test.penalties)
+			}
+		})
+	}
+}
+
+func TestBillingDocuments(t *testing.T) {
+	ledger := newTestLedger(t, 1000)
+	ledger.mustInvoke("setPriceSchedule", "Thyssen", thyssenPrices)
+	// a late repair at 11000 and one in time at 50000, each charged 2h labour and the call-out fee
+	ledger.reportFailure("DO0001")
+	ledger.advanceTicket("0001", stateOnTheWay)
+	ledger.stub.time = 11000
+	ledger.advanceTicket("0001", stateDone)
+	ledger.stub.time = 50000
+	ledger.reportFailure("BR0002")
+	ledger.advanceTicket("0002", stateDone)
+
+	tests := []struct {
+		function string
+		args     []string
+		valid    bool
+		want     BillingBalance // balance of Thyssen afterwards
+	}{
+		{"issueBillingDocuments", []string{"Thyssen", "50000", "11000"}, false,
+			BillingBalance{Unbilled: 45200}},
+		{"issueBillingDocuments", []string{"Thyssen", "0", "50000"}, true,
+			BillingBalance{Unbilled: 25100, OpenInvoices: 25100, OpenCreditNotes: -5000}},
+		{"issueBillingDocuments", []string{"Thyssen", "0", "50000"}, true,
+			BillingBalance{Unbilled: 25100, OpenInvoices: 25100, OpenCreditNotes: -5000}},
+		{"settleBillingDocument", []string{"00000001"}, true,
+			BillingBalance{Unbilled: 25100, SettledInvoices: 25100, OpenCreditNotes: -5000}},
+		{"settleBillingDocument", []string{"00000001"}, false,
+			BillingBalance{Unbilled: 25100, SettledInvoices: 25100, OpenCreditNotes: -5000}},
+		{"settleBillingDocument", []string{"00000009"}, false,
+			BillingBalance{Unbilled: 25100, SettledInvoices: 25100, OpenCreditNotes: -5000}},
+		{"issueBillingDocuments", []string{"thyssen", "50000", "50001"}, true,
+			BillingBalance{OpenInvoices: 25100, SettledInvoices: 25100, OpenCreditNotes: -5000}},
+	}
+	for _, test := range tests {
+		if err := ledger.invoke(test.function, test.args...); (err == nil) != test.valid {
+			t.Errorf("%s%q: err = %v", test.function, test.args, err)
+		}
+		test.want.ServiceProvider = "Thyssen"
+		if balance := ledger.billingBalance("Thyssen"); balance != test.want {
+			t.Errorf("after %s%q: balance = %+v, want %+v", test.function, test.args, balance, test.want)
+		}
+	}
+
+	result, err := ledger.query("getBillingDocuments", "Thyssen", "OPEN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var documents []BillingDocument
+	ledger.unmarshal(result, &documents)
+	if len(documents) != 2 || documents[0].Kind != documentCreditNote || documents[1].Kind != documentInvoice ||
+		documents[1].PeriodStart != 50000 || len(documents[1].ChargeIDs) != 1 {
+		t.Errorf("open documents = %s", result)
+	}
+	for _, charge := range ledger.ticketCharges("0001") {
+		if want := map[string]string{chargeRepair: "00000001", chargePenalty: "00000002"}[charge.Kind]; charge.DocumentID != want {
+			t.Errorf("%s charge of ticket 0001 issued with %q, want %q", charge.Kind, charge.DocumentID, want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Comment threads on tickets
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// A Comment is one message in the thread of a ticket. Comments are only ever appended, never edited.
+type Comment struct {
+	Seq             int    // position of the comment in the thread, starting at 1
+	Author          string // submitter of the transaction, see getCaller
+	Role            string // "OPERATOR", "DISPATCHER" or "MECHANIC"
+	ServiceProvider string // provider of the author, see getCallerProvider. Empty for the station operator
+	Visibility      string // "INTERNAL" (only visible to the author's service provider, not stored in the ticket) or "SHARED"
+	Text            string
+	Time            int64
+}
+
+const (
+	visibilityInternal = "INTERNAL"
+	visibilityShared   = "SHARED"
+)
+
+// Append a comment to the thread of a ticket. Arguments are the TicketID, the visibility (INTERNAL or SHARED) and the
+// text. The role of the author is the "role" attribute of the caller's certificate (OPERATOR, DISPATCHER or MECHANIC).
+// INTERNAL comments are notes of a service provider, they cannot be written by the station operator and are not
+// stored in the ticket, so only getComments returns them to the same service provider. Their history event leaves
+// out the text.
+func (t *SimpleChaincode) addComment(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 3 {
+		return nil, errors.New("Wrong number of arguments, must be 3: TicketID, visibility and text")
+	}
+	role, err := getCallerRole(stub)
+	if err != nil {
+		return nil, err
+	}
+	visibility := strings.ToUpper(args[1])
+	if visibility != visibilityInternal && visibility != visibilityShared {
+		return nil, errors.New("Unknown visibility " + args[1] + ", must be INTERNAL or SHARED")
+	}
+	if visibility == visibilityInternal && (role == roleOperator || getCallerProvider(stub) == "") {
+		return nil, errors.New("INTERNAL comments are reserved for callers with a serviceProvider attribute")
+	}
+	if len(strings.TrimSpace(args[2])) == 0 {
+		return nil, errors.New("Comment text must not be empty")
+	}
+
+	ticket, err := getTicket(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if err = ticket.transition("addComment"); err != nil {
+		return nil, err
+	}
+	if err = ticket.appendComment(stub, role, visibility, args[2]); err != nil || visibility == visibilityInternal {
+		return nil, err
+	}
+
+	return nil, putTicket(stub, ticket, "addComment")
+}
+
+// returns the comment thread of a ticket in the order the comments were written. Input is the TicketID. INTERNAL
+// comments are only returned to callers of the service provider that wrote them, see getCallerProvider.
+func (t *SimpleChaincode) getComments(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Wrong number of arguments, must be 1: TicketID")
+	}
+
+	ticket, err := getTicket(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	comments := append([]Comment{}, ticket.Comments...)
+	if provider := getCallerProvider(stub); provider != "" {
+		internal, err := getInternalComments(stub, ticket.TicketID)
+		if err != nil {
+			return nil, err
+		}
+		for _, comment := range internal {
+			if strings.EqualFold(comment.ServiceProvider, provider) {
+				comments = append(comments, comment)
+			}
+		}
+		sort.Sort(bySeq(comments))
+	}
+	return json.Marshal(comments)
+}
+
+// appendComment adds a comment by the caller of the current transaction to the ticket's thread. SHARED comments are
+// added to the ticket, which the caller has to write afterwards. INTERNAL ones are written to their own key, together
+// with a history event of the ticket without their text.
+func (ticket *Ticket) appendComment(stub shim.ChaincodeStubInterface, role string, visibility string, text string) error {
+	internal, err := getInternalComments(stub, ticket.TicketID)
+	if err != nil {
+		return err
+	}
+	comment := Comment{
+		Seq:             len(ticket.Comments) + len(internal) + 1,
+		Author:          getCaller(stub),
+		Role:            role,
+		ServiceProvider: getCallerProvider(stub),
+		Visibility:      visibility,
+		Text:            text,
+		Time:            getTransactionTime(stub),
+	}
+	if visibility != visibilityInternal {
+		ticket.Comments = append(ticket.Comments, comment)
+		return nil
+	}
+
+	internalAsByteArr, err := json.Marshal(append(internal, comment))
+	if err != nil {
+		return err
+	}
+	if err = stub.PutState(internalCommentsKey(ticket.TicketID), internalAsByteArr); err != nil {
+		return err
+	}
+	comment.Text = ""
+	redactedAsByteArr, err := json.Marshal(comment)
+	if err != nil {
+		return err
+	}
+	return appendTicketEvent(stub, ticket.TicketID, "addComment",
+		[]FieldChange{{Field: "InternalComments", New: redactedAsByteArr}})
+}
+
+// getInternalComments returns the INTERNAL comments of a ticket.
+func getInternalComments(stub shim.ChaincodeStubInterface, ticketID string) ([]Comment, error) {
+	internalAsByteArr, err := stub.GetState(internalCommentsKey(ticketID))
+	if err != nil || internalAsByteArr == nil {
+		return nil, err
+	}
+	var internal []Comment
+	if err = json.Unmarshal(internalAsByteArr, &internal); err != nil {
+		return nil, err
+	}
+	return internal, nil
+}
+
+func internalCommentsKey(ticketID string) string {
+	return "internalComments/" + ticketID
+}
+
+// bySeq sorts comments by their position in the thread.
+type bySeq []Comment
+
+func (c bySeq) Len() int           { return len(c) }
+func (c bySeq) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c bySeq) Less(i, j int) bool { return c[i].Seq < c[j].Seq }
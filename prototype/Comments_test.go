@@ -0,0 +1,134 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// commentCallers are the certificate attributes of the callers in the comment tests.
+var commentCallers = map[string]map[string]string{
+	"betrieb":   {"username": "betrieb", "role": roleOperator},
+	"hans":      {"username": "hans", "role": roleMechanic, "serviceProvider": "Thyssen"},
+	"disponent": {"username": "disponent", "role": roleDispatcher, "serviceProvider": "thyssen"},
+	"eva":       {"username": "eva", "role": roleMechanic, "serviceProvider": "Otis"},
+	"anonym":    {},
+}
+
+func (ledger *testLedger) callAs(caller string) {
+	ledger.stub.attributes = map[string]string{}
+	for name, value := range commentCallers[caller] {
+		ledger.stub.attributes[name] = value
+	}
+}
+
+func TestAddComment(t *testing.T) {
+	tests := []struct {
+		caller string
+		args   []string // arguments after the TicketID
+		valid  bool
+	}{
+		{"betrieb", []string{"shared", "Bitte bis 6 Uhr fertig"}, true},
+		{"betrieb", []string{"INTERNAL", "Notiz"}, false},
+		{"hans", []string{"INTERNAL", "Ersatzmotor fehlt"}, true},
+		{"hans", []string{"PRIVATE", "Notiz"}, false},
+		{"hans", []string{"SHARED", " "}, false},
+		{"hans", []string{"SHARED"}, false},
+		{"anonym", []string{"SHARED", "Notiz"}, false},
+		{"eva", []string{"INTERNAL", "Motor bei uns auf Lager"}, true},
+	}
+	ledger := newTestLedger(t, 1000)
+	ledger.reportFailure("DO0001")
+	for _, test := range tests {
+		ledger.callAs(test.caller)
+		if err := ledger.invoke("addComment", append([]string{"0001"}, test.args...)...); (err == nil) != test.valid {
+			t.Errorf("addComment%q as %s: err = %v", test.args, test.caller, err)
+		}
+	}
+	if err := ledger.invoke("addComment", "0099", "SHARED", "Notiz"); err == nil {
+		t.Error("addComment on an unknown ticket was accepted")
+	}
+	if comments := ledger.ticket("0001").Comments; len(comments) != 1 || comments[0].Role != roleOperator {
+		t.Errorf("ticket comments = %+v, want only the SHARED one", comments)
+	}
+}
+
+func TestGetComments(t *testing.T) {
+	ledger := newTestLedger(t, 1000)
+	ledger.reportFailure("DO0001")
+	ledger.advanceTicket("0001", stateOnTheWay)
+	comments := []struct {
+		caller, visibility, text string
+	}{
+		{"betrieb", visibilityShared, "Bitte bis 6 Uhr fertig"},
+		{"hans", visibilityInternal, "Ersatzmotor fehlt"},
+		{"eva", visibilityInternal, "Motor bei uns auf Lager"},
+		{"disponent", visibilityShared, "Techniker ist unterwegs"},
+	}
+	for _, comment := range comments {
+		ledger.callAs(comment.caller)
+		ledger.mustInvoke("addComment", "0001", comment.visibility, comment.text)
+	}
+	ledger.callAs("hans")
+	ledger.advanceTicket("0001", stateOnSite) // onArrival adds the commentary as SHARED comment
+
+	tests := []struct {
+		caller string
+		want   []int // Seq of the returned comments
+	}{
+		{"betrieb", []int{1, 4, 5}},
+		{"anonym", []int{1, 4, 5}},
+		{"hans", []int{1, 2, 4, 5}},
+		{"disponent", []int{1, 2, 4, 5}},
+		{"eva", []int{1, 3, 4, 5}},
+	}
+	for _, test := range tests {
+		ledger.callAs(test.caller)
+		result, err := ledger.query("getComments", "0001")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var thread []Comment
+		ledger.unmarshal(result, &thread)
+		var seqs []int
+		for _, comment := range thread {
+			seqs = append(seqs, comment.Seq)
+		}
+		if len(seqs) != len(test.want) {
+			t.Errorf("getComments as %s = %v, want %v", test.caller, seqs, test.want)
+			continue
+		}
+		for i := range seqs {
+			if seqs[i] != test.want[i] {
+				t.Errorf("getComments as %s = %v, want %v", test.caller, seqs, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestInternalCommentHistory(t *testing.T) {
+	ledger := newTestLedger(t, 1000)
+	ledger.reportFailure("DO0001")
+	ledger.callAs("hans")
+	ledger.mustInvoke("addComment", "0001", "INTERNAL", "Ersatzmotor fehlt")
+
+	result, err := ledger.query("getTicketHistory", "0001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(result), "Ersatzmotor") {
+		t.Errorf("history contains the text of an INTERNAL comment: %s", result)
+	}
+	var events []TicketEvent
+	ledger.unmarshal(result, &events)
+	last := events[len(events)-1]
+	if last.Action != "addComment" || last.Caller != "hans" || len(last.Changes) != 1 {
+		t.Fatalf("last event = %+v", last)
+	}
+	var comment Comment
+	ledger.unmarshal(last.Changes[0].New, &comment)
+	if comment.Seq != 1 || comment.Author != "hans" || comment.ServiceProvider != "Thyssen" ||
+		comment.Visibility != visibilityInternal {
+		t.Errorf("redacted comment = %+v", comment)
+	}
+}
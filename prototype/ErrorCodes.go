@@ -0,0 +1,217 @@
+// Error code catalogue
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// An ErrorCode describes an error code reported for assets of a type, optionally only for the assets of one
+// manufacturer. Tickets naming the code are completed with its details when they are created, see completeTicket.
+type ErrorCode struct {
+	ErrorID      string
+	AssetType    string
+	Manufacturer string // "" if the code means the same for every manufacturer, see MasterData.Manufacturer
+	Description  string // ErrorMessage of tickets created without one
+	Category     string // normalized fault category from faultCategories
+	TechPart     string // part usually affected, TechPart of tickets created without one
+	Severity     string // one of severities
+	Action       string // recommended action for the mechanic
+}
+
+// catalogue of normalized fault categories (ErrorCode.Category)
+var faultCategories = map[string]string{
+	"DRIVE":         "motor, gearbox or drive chain",
+	"BRAKE":         "service or emergency brake",
+	"STEPS":         "steps, pallets, comb plates or the car",
+	"HANDRAIL":      "handrail and its drive",
+	"DOOR":          "doors and their drive or locks",
+	"SAFETY":        "safety devices, sensors and emergency systems",
+	"CONTROL":       "controller, display or its software",
+	"POWER":         "power supply",
+	"COMMUNICATION": "connection to backends or the control centre",
+	"PAYMENT":       "payment terminal, coin or note validator",
+	"OTHER":         "not covered by the other categories",
+}
+
+// severity levels of error codes (ErrorCode.Severity), from least to most severe
+var severities = []string{"LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+// error code reported by createDefaultTicket, part of the catalogue of every new ledger
+var defaultErrorCode = ErrorCode{
+	ErrorID:     "#2356-102",
+	AssetType:   assetTypeEscalator,
+	Description: "Totalausfall",
+	Category:    "DRIVE",
+	TechPart:    "Motor RTM-X 64",
+	Severity:    "CRITICAL",
+	Action:      "Motor pruefen, bei Defekt RTM-X 64 tauschen",
+}
+
+// error codes of the asset types every ledger starts with, see builtinAssetTypes
+var builtinErrorCodes = []ErrorCode{
+	{ErrorID: "EL-DOOR", AssetType: "ELEVATOR", Description: "car or landing door does not open or close", Category: "DOOR", Severity: "HIGH"},
+	{ErrorID: "EL-LEVELING", AssetType: "ELEVATOR", Description: "car stops above or below the landing", Category: "DRIVE", Severity: "MEDIUM"},
+	{ErrorID: "EL-EMERGENCY", AssetType: "ELEVATOR", Description: "emergency call or alarm system out of order", Category: "SAFETY", Severity: "CRITICAL"},
+	{ErrorID: "EL-STANDSTILL", AssetType: "ELEVATOR", Description: "car does not move", Category: "DRIVE", Severity: "CRITICAL"},
+	{ErrorID: "AD-SENSOR", AssetType: "AUTOMATIC_DOOR", Description: "motion or safety sensor faulty", Category: "SAFETY", Severity: "HIGH"},
+	{ErrorID: "AD-DRIVE", AssetType: "AUTOMATIC_DOOR", Description: "door drive faulty, door does not move", Category: "DOOR", Severity: "HIGH"},
+	{ErrorID: "AD-LOCK", AssetType: "AUTOMATIC_DOOR", Description: "door does not lock or unlock", Category: "DOOR", Severity: "MEDIUM"},
+	{ErrorID: "TM-PRINTER", AssetType: "TICKET_MACHINE", Description: "tickets are not printed", Category: "OTHER", Severity: "MEDIUM"},
+	{ErrorID: "TM-PAYMENT", AssetType: "TICKET_MACHINE", Description: "payment terminal or coin validator faulty", Category: "PAYMENT", Severity: "HIGH"},
+	{ErrorID: "TM-DISPLAY", AssetType: "TICKET_MACHINE", Description: "display or touch screen faulty", Category: "CONTROL", Severity: "MEDIUM"},
+	{ErrorID: "TM-NETWORK", AssetType: "TICKET_MACHINE", Description: "no connection to the sales backend", Category: "COMMUNICATION", Severity: "HIGH"},
+}
+
+// Create or replace an entry of the error code catalogue. Input is the ErrorCode as JSON. Once the catalogue has an
+// entry for an asset type, tickets for assets of the type are only accepted with ErrorIDs catalogued for their
+// manufacturer or for all manufacturers, see checkErrorID.
+func (t *SimpleChaincode) defineErrorCode(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Wrong number of arguments, must be 1: error code as JSON")
+	}
+	var code ErrorCode
+	if err := json.Unmarshal([]byte(args[0]), &code); err != nil {
+		return nil, errors.New("Error code is no valid JSON: " + err.Error())
+	}
+	return nil, addErrorCode(stub, &code)
+}
+
+// returns the error code catalogue, ordered by AssetType, Manufacturer and ErrorID. Input is optionally an AssetType
+// to return only its codes.
+func (t *SimpleChaincode) getErrorCodes(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) > 1 {
+		return nil, errors.New("Wrong number of arguments, must be 0 or 1: optionally an AssetType")
+	}
+	prefix := errorCodePrefix("")
+	if len(args) == 1 {
+		prefix = errorCodePrefix(args[0])
+	}
+	return getRangeAsJSONArray(stub, prefix, prefix+"~")
+}
+
+// returns the catalogue of fault categories
+func (t *SimpleChaincode) getFaultCategories(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	return json.Marshal(faultCategories)
+}
+
+// addErrorCode validates the code and writes it to the catalogue.
+func addErrorCode(stub shim.ChaincodeStubInterface, code *ErrorCode) error {
+	code.ErrorID = strings.TrimSpace(code.ErrorID)
+	if code.ErrorID == "" || strings.ContainsAny(code.ErrorID, "/~") {
+		return errors.New("ErrorID must not be empty or contain / or ~")
+	}
+	if strings.ContainsAny(code.Manufacturer, "/~") {
+		return errors.New("Manufacturer must not contain / or ~")
+	}
+	assetType, err := getAssetType(stub, code.AssetType)
+	if err != nil {
+		return err
+	}
+	code.AssetType = assetType.AssetType
+	code.Category = strings.ToUpper(code.Category)
+	if _, ok := faultCategories[code.Category]; !ok {
+		return errors.New("Unknown fault category " + code.Category + ", see getFaultCategories")
+	}
+	code.Severity = strings.ToUpper(code.Severity)
+	if !isSeverity(code.Severity) {
+		return errors.New("Unknown severity " + code.Severity + ", must be one of " + strings.Join(severities, ", "))
+	}
+
+	codeAsByteArr, err := json.Marshal(code)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(errorCodeKey(code.AssetType, code.Manufacturer, code.ErrorID), codeAsByteArr)
+}
+
+// checkErrorID rejects an ErrorID without catalogue entry for the asset, see lookupErrorCode. Asset types without any
+// entry in the catalogue accept any ErrorID, as before the catalogue existed.
+func checkErrorID(stub shim.ChaincodeStubInterface, asset *Asset, errorID string) error {
+	code, err := lookupErrorCode(stub, asset, errorID)
+	if err != nil || code != nil {
+		return err
+	}
+	prefix := errorCodePrefix(asset.AssetType)
+	resultsIterator, err := stub.RangeQueryState(prefix, prefix+"~")
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+	if !resultsIterator.HasNext() {
+		return nil
+	}
+	return errors.New("Unknown ErrorID " + errorID + " for asset " + asset.AssetID + " of type " + asset.AssetType + ", see getErrorCodes")
+}
+
+// completeTicket sets the fault category, severity and recommended action of a new ticket from the catalogue entry of
+// its ErrorID, and its TechPart and ErrorMessage if it has none. Tickets for devices that are not registered as asset
+// or with an ErrorID without entry are left as they are.
+func completeTicket(stub shim.ChaincodeStubInterface, ticket *Ticket) error {
+	asset, err := findAsset(stub, ticket.Device)
+	if err != nil || asset == nil {
+		return err
+	}
+	code, err := lookupErrorCode(stub, asset, ticket.ErrorID)
+	if err != nil || code == nil {
+		return err
+	}
+	code.complete(ticket)
+	return nil
+}
+
+func (code *ErrorCode) complete(ticket *Ticket) {
+	ticket.FaultCategory = code.Category
+	ticket.Severity = code.Severity
+	ticket.RecommendedAction = code.Action
+	if ticket.TechPart == "" {
+		ticket.TechPart = code.TechPart
+	}
+	if ticket.ErrorMessage == "" {
+		ticket.ErrorMessage = code.Description
+	}
+}
+
+// lookupErrorCode returns the catalogue entry of the ErrorID for the manufacturer of the asset, or the one for all
+// manufacturers. nil if there is neither.
+func lookupErrorCode(stub shim.ChaincodeStubInterface, asset *Asset, errorID string) (*ErrorCode, error) {
+	manufacturers := []string{""}
+	if asset.Manufacturer != "" {
+		manufacturers = []string{asset.Manufacturer, ""}
+	}
+	for _, manufacturer := range manufacturers {
+		codeAsByteArr, err := stub.GetState(errorCodeKey(asset.AssetType, manufacturer, errorID))
+		if err != nil {
+			return nil, err
+		}
+		if codeAsByteArr != nil {
+			code := new(ErrorCode)
+			return code, json.Unmarshal(codeAsByteArr, code)
+		}
+	}
+	return nil, nil
+}
+
+func isSeverity(s string) bool {
+	for _, severity := range severities {
+		if s == severity {
+			return true
+		}
+	}
+	return false
+}
+
+func errorCodeKey(assetType string, manufacturer string, errorID string) string {
+	return errorCodePrefix(assetType) + strings.ToLower(manufacturer) + "/" + errorID
+}
+
+// errorCodePrefix is the start of the keys of all error codes of the asset type, or of the whole catalogue for "".
+func errorCodePrefix(assetType string) string {
+	if assetType == "" {
+		return "errorCode/"
+	}
+	return "errorCode/" + strings.ToUpper(assetType) + "/"
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// defineErrorCodes adds the ErrorIDs to the error code catalogue of the asset type, for all manufacturers.
+func (ledger *testLedger) defineErrorCodes(assetType string, errorIDs ...string) {
+	for _, errorID := range errorIDs {
+		ledger.mustInvoke("defineErrorCode",
+			`{"ErrorID":"`+errorID+`","AssetType":"`+assetType+`","Category":"OTHER","Severity":"MEDIUM"}`)
+	}
+}
+
+func TestDefineErrorCode(t *testing.T) {
+	tests := []struct {
+		code  string
+		valid bool
+		want  ErrorCode // catalogue entry afterwards
+	}{
+		{`{"ErrorID":" H-17 ","AssetType":"escalator","Description":"Handlauf steht","Category":"handrail",` +
+			`"TechPart":"Handlaufantrieb","Severity":"high","Action":"Antriebskette pruefen"}`, true,
+			ErrorCode{"H-17", "ESCALATOR", "", "Handlauf steht", "HANDRAIL", "Handlaufantrieb", "HIGH", "Antriebskette pruefen"}},
+		{`{"ErrorID":"H-17","AssetType":"ESCALATOR","Manufacturer":"Schindler","Category":"STEPS","Severity":"LOW"}`,
+			true, ErrorCode{"H-17", "ESCALATOR", "Schindler", "", "STEPS", "", "LOW", ""}},
+		{`{"ErrorID":"H-17","AssetType":"MONORAIL","Category":"OTHER","Severity":"LOW"}`, false, ErrorCode{}},
+		{`{"ErrorID":"H-17","AssetType":"ESCALATOR","Category":"WETTER","Severity":"LOW"}`, false, ErrorCode{}},
+		{`{"ErrorID":"H-17","AssetType":"ESCALATOR","Category":"OTHER","Severity":"DRINGEND"}`, false, ErrorCode{}},
+		{`{"ErrorID":" ","AssetType":"ESCALATOR","Category":"OTHER","Severity":"LOW"}`, false, ErrorCode{}},
+		{`{"ErrorID":"H/17","AssetType":"ESCALATOR","Category":"OTHER","Severity":"LOW"}`, false, ErrorCode{}},
+		{`{"ErrorID":"H-17","AssetType":"ESCALATOR","Manufacturer":"Otis/Kone","Category":"OTHER","Severity":"LOW"}`,
+			false, ErrorCode{}},
+		{`H-17`, false, ErrorCode{}},
+	}
+	for _, test := range tests {
+		ledger := newTestLedger(t, 1000)
+		if err := ledger.invoke("defineErrorCode", test.code); (err == nil) != test.valid {
+			t.Errorf("defineErrorCode(%s): err = %v", test.code, err)
+			continue
+		}
+		if !test.valid {
+			continue
+		}
+		result, err := ledger.query("getErrorCodes", "escalator")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var codes []ErrorCode
+		ledger.unmarshal(result, &codes)
+		if len(codes) != 2 || codes[0] != defaultErrorCode || codes[1] != test.want {
+			t.Errorf("after defineErrorCode(%s): getErrorCodes = %+v", test.code, codes)
+		}
+	}
+}
+
+func TestCreateTicketFromErrorCode(t *testing.T) {
+	tests := []struct {
+		name         string
+		manufacturer string // Manufacturer of DO0001
+		args         []string
+		valid        bool
+		want         [5]string // TechPart, ErrorMessage, FaultCategory, Severity and RecommendedAction of ticket 0001
+	}{
+		{"completed from the catalogue", "", []string{"DO", "4", "DO0001", "#2356-102"}, true,
+			[5]string{"Motor RTM-X 64", "Totalausfall", "DRIVE", "CRITICAL", defaultErrorCode.Action}},
+		{"reported details are kept", "", []string{"DO", "4", "DO0001", "Motor", "#2356-102", "Motor brummt"}, true,
+			[5]string{"Motor", "Motor brummt", "DRIVE", "CRITICAL", defaultErrorCode.Action}},
+		{"code of the manufacturer", "Schindler", []string{"DO", "4", "DO0001", "H-17"}, true,
+			[5]string{"Handlauf", "Handlauf steht", "HANDRAIL", "HIGH", ""}},
+		{"code for all manufacturers", "Schindler", []string{"DO", "4", "DO0001", "#2356-102"}, true,
+			[5]string{"Motor RTM-X 64", "Totalausfall", "DRIVE", "CRITICAL", defaultErrorCode.Action}},
+		{"code of another manufacturer", "Otis", []string{"DO", "4", "DO0001", "H-17"}, false, [5]string{}},
+		{"code not catalogued", "", []string{"DO", "4", "DO0001", "H-18"}, false, [5]string{}},
+		{"wrong number of arguments", "", []string{"DO", "4", "DO0001", "Motor", "#2356-102"}, false, [5]string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ledger := newTestLedger(t, 1000)
+			ledger.mustInvoke("defineErrorCode", `{"ErrorID":"H-17","AssetType":"ESCALATOR","Manufacturer":"schindler",`+
+				`"Description":"Handlauf steht","Category":"HANDRAIL","TechPart":"Handlauf","Severity":"HIGH"}`)
+			if test.manufacturer != "" {
+				ledger.mustInvoke("updateEscalator", "DO0001", `{"Manufacturer":"`+test.manufacturer+`"}`)
+			}
+			if err := ledger.invoke("createTicket", test.args...); (err == nil) != test.valid {
+				t.Fatalf("createTicket%q: err = %v", test.args, err)
+			}
+			if !test.valid {
+				return
+			}
+			ticket := ledger.ticket("0001")
+			got := [5]string{ticket.TechPart, ticket.ErrorMessage, ticket.FaultCategory, ticket.Severity,
+				ticket.RecommendedAction}
+			if got != test.want {
+				t.Errorf("ticket 0001 = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestErrorCodeCatalogueOfType(t *testing.T) {
+	// a type without catalogue entries accepts any ErrorID, once it has one only catalogued ErrorIDs
+	ledger := newTestLedger(t, 1000)
+	ledger.mustInvoke("defineAssetType", `{"AssetType":"WC","Name":"Toilette"}`)
+	ledger.mustInvoke("createAsset", "WC", "DO", "4")
+	ledger.mustInvoke("createTicket", "DO", "4", "DO0003", "Tuer", "WC-1", "Tuer klemmt")
+	ledger.advanceTicket("0001", stateDone)
+
+	ledger.defineErrorCodes("WC", "WC-2")
+	if err := ledger.invoke("createTicket", "DO", "4", "DO0003", "Tuer", "WC-1", "Tuer klemmt"); err == nil {
+		t.Error("createTicket accepted WC-1, which is not in the catalogue of WC")
+	}
+	if err := ledger.invoke("setAssetState", "DO0003", "false", "Tuer", "WC-1", "Tuer klemmt"); err == nil {
+		t.Error("setAssetState accepted WC-1, which is not in the catalogue of WC")
+	}
+	ledger.mustInvoke("createTicket", "DO", "4", "DO0003", "Tuer", "WC-2", "Tuer klemmt")
+}
+
+func TestCreateDefaultTicket(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(ledger *testLedger) // prepares the ledger
+		valid  bool
+		want   [2]string // TechPart and FaultCategory of ticket 0001
+	}{
+		{"new ledger", func(ledger *testLedger) {}, true, [2]string{"Motor RTM-X 64", "DRIVE"}},
+		{"changed catalogue entry", func(ledger *testLedger) {
+			ledger.mustInvoke("defineErrorCode", `{"ErrorID":"#2356-102","AssetType":"ESCALATOR","TechPart":"Motor RTM-X 80",`+
+				`"Description":"Motor ueberhitzt","Category":"POWER","Severity":"HIGH"}`)
+		}, true, [2]string{"Motor RTM-X 80", "POWER"}},
+		{"ledger without catalogue", func(ledger *testLedger) {
+			delete(ledger.stub.state, errorCodeKey(assetTypeEscalator, "", "#2356-102"))
+		}, true, [2]string{"Motor RTM-X 64", "DRIVE"}},
+		{"decommissioned", func(ledger *testLedger) {
+			ledger.mustInvoke("decommissionEscalator", "DO0001", "Abriss des Bahnsteigs")
+		}, false, [2]string{}},
+		{"missing escalator", func(ledger *testLedger) {
+			delete(ledger.stub.state, assetKey("DO0001"))
+		}, false, [2]string{}},
+		{"unreadable escalator", func(ledger *testLedger) {
+			ledger.stub.state[assetKey("DO0001")] = []byte("{")
+		}, false, [2]string{}},
+		{"unreadable catalogue entry", func(ledger *testLedger) {
+			ledger.stub.state[errorCodeKey(assetTypeEscalator, "", "#2356-102")] = []byte("{")
+		}, false, [2]string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ledger := newTestLedger(t, 1000)
+			test.change(ledger)
+			ledger.stub.commit()
+			if err := ledger.invoke("createDefaultTicket"); (err == nil) != test.valid {
+				t.Fatalf("createDefaultTicket: err = %v", err)
+			}
+			if !test.valid {
+				return
+			}
+			ticket := ledger.ticket("0001")
+			if got := [2]string{ticket.TechPart, ticket.FaultCategory}; got != test.want || ticket.Device != "DO0001" ||
+				ticket.ErrorID != "#2356-102" || ticket.ErrorMessage == "" {
+				t.Errorf("ticket 0001 = %+v", ticket)
+			}
+		})
+	}
+}
+
+func TestCreateTicketUnreadableErrorCode(t *testing.T) {
+	ledger := newTestLedger(t, 1000)
+	ledger.stub.state[errorCodeKey(assetTypeEscalator, "", "#2356-102")] = []byte("{")
+	ledger.stub.commit()
+	if err := ledger.invoke("createTicket", "DO", "4", "DO0001", "Motor", "#2356-102", "Totalausfall"); err == nil {
+		t.Error("createTicket ignored the unreadable catalogue entry")
+	}
+}
+
+func TestGetErrorCodes(t *testing.T) {
+	ledger := newTestLedger(t, 1000)
+	tests := []struct {
+		args []string
+		want int // number of codes
+	}{
+		{nil, len(builtinErrorCodes) + 1},
+		{[]string{"escalator"}, 1},
+		{[]string{"TICKET_MACHINE"}, 4},
+		{[]string{"MONORAIL"}, 0},
+	}
+	for _, test := range tests {
+		result, err := ledger.query("getErrorCodes", test.args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var codes []ErrorCode
+		ledger.unmarshal(result, &codes)
+		if len(codes) != test.want {
+			t.Errorf("getErrorCodes%q returned %d codes, want %d", test.args, len(codes), test.want)
+		}
+	}
+
+	result, err := ledger.query("getFaultCategories")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var categories map[string]string
+	ledger.unmarshal(result, &categories)
+	if !reflect.DeepEqual(categories, faultCategories) {
+		t.Errorf("getFaultCategories = %s", result)
+	}
+}
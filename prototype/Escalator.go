@@ -15,13 +15,6 @@ import (
 type SimpleChaincode struct {
 }
 
-type Escalator struct {
-	EscalatorID  string
-	Trainstation string
-	Platform     string
-	IsWorking    bool
-}
-
 //simple SLA.
 type ServiceLevelAgreement struct {
 	ServiceProvider string
@@ -31,26 +24,122 @@ type ServiceLevelAgreement struct {
 	None   int64 //no violation
 	Light  int64
 	Severe int64
+	// number of repairs by this provider after which the escalator failed again within the warranty window
+	RepeatFailures int64
 }
 
+// results of the SLA evaluation of a finished ticket, matching the counters of ServiceLevelAgreement
+const (
+	slaNone   = "None"
+	slaLight  = "Light"
+	slaSevere = "Severe"
+)
+
+// a mechanic arriving more than severeArrivalDelay seconds late, or a repair taking more than severeRepairDelay
+// seconds longer than agreed is a severe violation of the SLA
+const (
+	severeArrivalDelay = 10800
+	severeRepairDelay  = 14400
+)
+
+// default for the time in seconds after closing a ticket in which a new failure of the same escalator counts as
+// repeat failure. Can be changed with setWarrantyWindow.
+const defaultWarrantyWindow = 7 * 24 * 3600
+
 type Ticket struct {
-	TicketID        string
-	Timestamp       int64 // time of ticket creation
-	Trainstation    string
-	Platform        string
-	Device          string // the device in need of repairs (Some form of identifier for the escalator)
-	Status          string // current ticket status (not repair status), i.e. "OPEN".
-	TechPart        string // representing the defective part of the escalator
-	ErrorID         string
-	ErrorMessage    string
-	ServiceProvider string // the assigned service provider that is commissioned to do the repairs
-	SpEmployee      string // mechanic assigned by ServiceProvider
-	SpeCommentary   string // additional commentary, optionally to be filled out by the SpEmployee
-	EstRepairTime   string
-	TimeOfArrival   int64 // time of arrival
-	RepairStatus    string
-	FinalRepairTime int64 // closing the ticket
-	FinalReport     string
+	TicketID          string
+	Timestamp         int64 // time of ticket creation
+	Trainstation      string
+	Platform          string
+	StationID         string // registry IDs of Trainstation and Platform, empty for tickets created before the registry
+	PlatformID        string
+	Device            string // the device in need of repairs (AssetID, or some other form of identifier for unregistered devices)
+	Status            string // current ticket status (not repair status), i.e. "OPEN".
+	TechPart          string // representing the defective part of the escalator
+	ErrorID           string
+	ErrorMessage      string
+	ServiceProvider   string // the assigned service provider that is commissioned to do the repairs
+	SpEmployee        string // mechanic assigned by ServiceProvider
+	SpeCommentary     string // additional commentary, optionally to be filled out by the SpEmployee
+	EstRepairTime     string // latest estimate of the mechanic, see parseRepairDuration
+	TimeOfArrival     int64  // time of arrival
+	RepairStatus      string
+	FinalRepairTime   int64 // closing the ticket
+	FinalReport       string
+	SLAResult         string // outcome of the SLA evaluation in acceptRepair: "None", "Light" or "Severe"
+	PreviousTicketID  string // the closed ticket this one reopens, if the escalator failed again within the warranty window
+	RepeatFailure     bool
+	CancelReason      string // reason code from cancelReasons, set by cancelTicket
+	CancelComment     string
+	Handovers         []Handover    // every reassignment of the ticket to another service provider
+	SLAProvider       string        // provider the ticket is scored against if it is not the current ServiceProvider, see reassignTicket
+	SLAStart          int64         // start of the SLA clock if it is not the ticket creation time, see reassignTicket
+	Pauses            []Pause       // intervals in which the SLA clock was stopped, see pauseTicket
+	PausedDuration    int64         // seconds covered by approved pauses since the start of the SLA clock
+	Occurrences       []Occurrence  // further fault reports for the Device while the ticket was open
+	WorkingOverride   string        // reason given for setting the Device to working while the ticket was open
+	Report            *RepairReport // structured final report, its Text is also kept in FinalReport
+	AcceptedBy        string        // station operator that accepted the repair and closed the ticket
+	AcceptedAt        int64
+	AcceptComment     string
+	Rejections        []Rejection   // repairs the station operator did not accept
+	Comments          []Comment     // SHARED communication about the repair, see addComment
+	EstCompletion     int64         // predicted completion of the repair, from EstRepairTime
+	EtaRevisions      []EtaRevision // every revision of EstCompletion, see reviseEta
+	ArrivalPosition   *Position     // position reported by the mechanic in onArrival
+	ArrivalDistance   int64         // distance of ArrivalPosition to the Trainstation in meters
+	ArrivalCheck      string        // result of the arrival verification, e.g. "VERIFIED" or "OUTSIDE_GEOFENCE"
+	Kind              string        // "" for a fault report, "MAINTENANCE" for a planned maintenance, see MaintenancePlan
+	PlanID            string        // plan the maintenance ticket was generated from
+	DueDate           int64         // time by which the maintenance has to be finished
+	Tasks             []string      // task list of the maintenance
+	DueResult         string        // outcome of the due date check in acceptRepair or cancelTicket: "ON_TIME", "LATE" or "MISSED"
+	FaultCategory     string        // FaultCategory, Severity and RecommendedAction are taken from the ErrorCode of ErrorID
+	Severity          string
+	RecommendedAction string
+}
+
+// A Rejection records a repair the station operator did not accept, sending the ticket back to the service provider.
+type Rejection struct {
+	Reason          string
+	RejectedBy      string
+	Time            int64
+	FinalRepairTime int64 // completion time reported by the provider for the rejected repair
+}
+
+// An Occurrence is a fault report that setAssetState attached to an already open ticket instead of opening a new one.
+type Occurrence struct {
+	TechPart     string
+	ErrorID      string
+	ErrorMessage string
+	Time         int64
+}
+
+// A Handover records the reassignment of a ticket from one service provider to another.
+type Handover struct {
+	From          string
+	FromEmployee  string // mechanic of the previous provider, if one was assigned
+	To            string
+	Reason        string // reason code from handoverReasons
+	Comment       string
+	Time          int64
+	EstCompletion int64         // completion predicted by the previous provider, 0 if it had none
+	EtaRevisions  []EtaRevision // revisions of the prediction made by the previous provider
+}
+
+// catalogue of reason codes accepted by reassignTicket. The value tells whether the provider giving the ticket away
+// stays accountable for the SLA of the ticket.
+var handoverReasons = map[string]bool{
+	"PROVIDER_UNAVAILABLE": true,  // provider declined the ticket or cannot handle it
+	"PROVIDER_FAULT":       true,  // provider did not act on the ticket as agreed
+	"DISPATCH_ERROR":       false, // ticket was assigned to the wrong provider in the first place
+}
+
+// catalogue of reason codes accepted by cancelTicket
+var cancelReasons = map[string]string{
+	"FALSE_ALARM":    "the escalator was working, no repair necessary",
+	"DUPLICATE":      "the failure is already covered by another ticket",
+	"OPERATOR_ERROR": "the ticket was created by mistake",
 }
 
 func main() {
@@ -62,19 +151,36 @@ func main() {
 
 func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
 
-	//initialize counters for ticket and escalator ID creation
-	stub.PutState("escalatorCounter", []byte("0"))
-	stub.PutState("ticketCounter", []byte("0"))
+	//initialize counters for ticket and asset ID creation
+	stub.PutState(counterKey("asset"), []byte("0"))
+	stub.PutState(counterKey("ticket"), []byte("0"))
+	stub.PutState(configKey("warrantyWindow"), []byte(strconv.Itoa(defaultWarrantyWindow)))
+	stub.PutState(configKey("debounceWindow"), []byte(strconv.Itoa(defaultDebounceWindow)))
+	stub.PutState(configKey("keySchema"), []byte(keySchemaVersion))
+
+	//asset types with their error codes and the stations and platforms of the escalators below
+	for i := range builtinAssetTypes {
+		putAssetType(stub, &builtinAssetTypes[i])
+	}
+	for _, code := range append([]ErrorCode{defaultErrorCode}, builtinErrorCodes...) {
+		addErrorCode(stub, &code)
+	}
+	t.createStation(stub, []string{"DO", "Dortmund Hbf"})
+	t.createPlatform(stub, []string{"DO", "4", "Gleis 4"})
+	t.createStation(stub, []string{"BR", "Bremen Hbf"})
+	t.createPlatform(stub, []string{"BR", "1", "Gleis 1"})
 
 	//create an escalator to use with createDefaultTicket
 
-	t.createEscalator(stub, []string{"Dortmund Hbf", "Gleis 4"})
-	t.createEscalator(stub, []string{"Bremen Hbf", "Gleis 1"})
+	t.createEscalator(stub, []string{"DO", "4"})
+	t.createEscalator(stub, []string{"BR", "1"})
 	//init SLAs for stats/data board with semi-reasonable numbers
 	t.createSLA(stub, []string{"Thyssen", "7200", "28800", "119", "21", "10"})
 	t.createSLA(stub, []string{"Schindler", "7200", "28800", "90", "3", "8"})
 	t.createSLA(stub, []string{"Otis", "7200", "28800", "97", "20", "10"})
 	t.createSLA(stub, []string{"DBIntern", "7200", "28800", "81", "11", "10"})
+	//spare part used by createDefaultTicket
+	t.createPart(stub, []string{"RTM-X 64", "Motor RTM-X 64"})
 	return nil, nil
 }
 
@@ -82,14 +188,24 @@ func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface, function string
 func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
 
 	switch function {
-	case "setEscalatorState":
-		return t.setEscalatorState(stub, args)
+	case "setAssetState", "setEscalatorState":
+		return t.setAssetState(stub, args)
 	case "createSLA":
 		return t.createSLA(stub, args)
 	case "updateSLA":
 		return t.updateSLA(stub, args)
+	case "defineAssetType":
+		return t.defineAssetType(stub, args)
+	case "createAsset":
+		return t.createAsset(stub, args)
 	case "createEscalator":
 		return t.createEscalator(stub, args)
+	case "updateAsset", "updateEscalator":
+		return t.updateAsset(stub, args)
+	case "decommissionAsset", "decommissionEscalator":
+		return t.decommissionAsset(stub, args)
+	case "replaceAsset", "replaceEscalator":
+		return t.replaceAsset(stub, args)
 	case "createTicket":
 		return t.createTicket(stub, args)
 	case "createDefaultTicket":
@@ -98,6 +214,14 @@ func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface, function stri
 		return t.assignTicket(stub, args)
 	case "assignMechanic":
 		return t.assignMechanic(stub, args)
+	case "reassignTicket":
+		return t.reassignTicket(stub, args)
+	case "pauseTicket":
+		return t.pauseTicket(stub, args)
+	case "resumeTicket":
+		return t.resumeTicket(stub, args)
+	case "decidePause":
+		return t.decidePause(stub, args)
 	case "startJourney":
 		return t.startJourney(stub, args)
 	case "onArrival":
@@ -108,6 +232,50 @@ func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface, function stri
 		return t.finishRepair(stub, args)
 	case "writeFinalReport":
 		return t.writeFinalReport(stub, args)
+	case "acceptRepair":
+		return t.acceptRepair(stub, args)
+	case "rejectRepair":
+		return t.rejectRepair(stub, args)
+	case "createPart":
+		return t.createPart(stub, args)
+	case "receiveParts":
+		return t.receiveParts(stub, args)
+	case "adjustStock":
+		return t.adjustStock(stub, args)
+	case "setPriceSchedule":
+		return t.setPriceSchedule(stub, args)
+	case "issueBillingDocuments":
+		return t.issueBillingDocuments(stub, args)
+	case "settleBillingDocument":
+		return t.settleBillingDocument(stub, args)
+	case "migrateKeys":
+		return t.migrateKeys(stub, args)
+	case "setWarrantyWindow":
+		return t.setWarrantyWindow(stub, args)
+	case "createStation":
+		return t.createStation(stub, args)
+	case "createPlatform":
+		return t.createPlatform(stub, args)
+	case "setStationLocation":
+		return t.setStationLocation(stub, args)
+	case "reviseEta":
+		return t.reviseEta(stub, args)
+	case "addComment":
+		return t.addComment(stub, args)
+	case "registerDeviceKey":
+		return t.registerDeviceKey(stub, args)
+	case "setDebounceWindow":
+		return t.setDebounceWindow(stub, args)
+	case "ingestTelemetry":
+		return t.ingestTelemetry(stub, args)
+	case "defineErrorCode":
+		return t.defineErrorCode(stub, args)
+	case "createMaintenancePlan":
+		return t.createMaintenancePlan(stub, args)
+	case "generateMaintenanceTickets":
+		return t.generateMaintenanceTickets(stub, args)
+	case "cancelTicket":
+		return t.cancelTicket(stub, args)
 
 	}
 
@@ -118,8 +286,22 @@ func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface, function stri
 func (t *SimpleChaincode) Query(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
 
 	switch function {
-	case "getEscalatorState":
-		return t.getEscalatorState(stub, args)
+	case "getAssetState", "getEscalatorState":
+		return t.getAssetState(stub, args)
+	case "getAsset", "getEscalator":
+		return t.getAsset(stub, args)
+	case "getAssets":
+		return t.getAssets(stub, args)
+	case "getAssetTypes":
+		return t.getAssetTypes(stub, args)
+	case "getStateChanges":
+		return t.getStateChanges(stub, args)
+	case "getAssetAvailability", "getEscalatorAvailability":
+		return t.getAssetAvailability(stub, args)
+	case "getStationAvailability":
+		return t.getStationAvailability(stub, args)
+	case "getProviderAvailability":
+		return t.getProviderAvailability(stub, args)
 	case "getSLA":
 		return t.getSLA(stub, args)
 	case "getFullTicket":
@@ -142,6 +324,64 @@ func (t *SimpleChaincode) Query(stub shim.ChaincodeStubInterface, function strin
 		return t.getWIPTickets(stub, args)
 	case "getNewSPTickets":
 		return t.getNewSPTickets(stub, args)
+	case "getAllowedActions":
+		return t.getAllowedActions(stub, args)
+	case "getComments":
+		return t.getComments(stub, args)
+	case "getTicketHistory":
+		return t.getTicketHistory(stub, args)
+	case "getWarrantyWindow":
+		return t.getWarrantyWindow(stub, args)
+	case "getCancelReasons":
+		return t.getCancelReasons(stub, args)
+	case "getHandoverReasons":
+		return t.getHandoverReasons(stub, args)
+	case "getPauseReasons":
+		return t.getPauseReasons(stub, args)
+	case "getParts":
+		return t.getParts(stub, args)
+	case "getStock":
+		return t.getStock(stub, args)
+	case "getPartsConsumptionByAsset", "getPartsConsumptionByEscalator":
+		return t.getPartsConsumptionByAsset(stub, args)
+	case "getPartsConsumptionByProvider":
+		return t.getPartsConsumptionByProvider(stub, args)
+	case "getPriceSchedule":
+		return t.getPriceSchedule(stub, args)
+	case "getTicketCharges":
+		return t.getTicketCharges(stub, args)
+	case "getBillingDocuments":
+		return t.getBillingDocuments(stub, args)
+	case "getBillingBalance":
+		return t.getBillingBalance(stub, args)
+	case "getRootCauses":
+		return t.getRootCauses(stub, args)
+	case "getReportsByRootCause":
+		return t.getReportsByRootCause(stub, args)
+	case "getStations":
+		return t.getStations(stub, args)
+	case "getPlatforms":
+		return t.getPlatforms(stub, args)
+	case "getFlaggedArrivals":
+		return t.getFlaggedArrivals(stub, args)
+	case "getPredictedBreaches":
+		return t.getPredictedBreaches(stub, args)
+	case "getDeviceTelemetry":
+		return t.getDeviceTelemetry(stub, args)
+	case "getDebounceWindow":
+		return t.getDebounceWindow(stub, args)
+	case "getErrorCodes":
+		return t.getErrorCodes(stub, args)
+	case "getFaultCategories":
+		return t.getFaultCategories(stub, args)
+	case "getMaintenancePlans":
+		return t.getMaintenancePlans(stub, args)
+	case "getMaintenanceSchedule":
+		return t.getMaintenanceSchedule(stub, args)
+	case "getOverdueTickets":
+		return t.getOverdueTickets(stub, args)
+	case "getOverdueTicketsByServiceProvider":
+		return t.getOverdueTicketsByServiceProvider(stub, args)
 	}
 	fmt.Println("query did not find func: " + function)
 	return nil, errors.New("Received unknown function query")
@@ -162,14 +402,12 @@ func (t *SimpleChaincode) createSLA(stub shim.ChaincodeStubInterface, args []str
 	sla.None, _ = strconv.ParseInt(args[3], 10, 64)
 	sla.Light, _ = strconv.ParseInt(args[4], 10, 64)
 	sla.Severe, _ = strconv.ParseInt(args[5], 10, 64)
-	slaKey := "sla" + strings.ToLower(args[0])
-
 	slaAsByteArr, err := json.Marshal(sla)
 
 	if err != nil {
 		return nil, err
 	}
-	stub.PutState(slaKey, slaAsByteArr)
+	stub.PutState(slaKey(args[0]), slaAsByteArr)
 	return slaAsByteArr, nil
 }
 
@@ -180,7 +418,7 @@ func (t *SimpleChaincode) updateSLA(stub shim.ChaincodeStubInterface, args []str
 	}
 
 	var sla ServiceLevelAgreement
-	slaAsByteArr, err := stub.GetState("sla" + strings.ToLower(args[0]))
+	slaAsByteArr, err := stub.GetState(slaKey(args[0]))
 	if err != nil {
 		return nil, err
 	}
@@ -189,72 +427,170 @@ func (t *SimpleChaincode) updateSLA(stub shim.ChaincodeStubInterface, args []str
 	sla.TimeToRepair, _ = strconv.ParseInt(args[2], 10, 64)
 
 	slaAsByteArr, _ = json.Marshal(sla)
-	stub.PutState("sla"+strings.ToLower(args[0]), slaAsByteArr)
+	stub.PutState(slaKey(args[0]), slaAsByteArr)
 	return nil, nil
 }
 
-//Takes either EscalatorID and "true" OR EscalatorID, "false", and 3 more : TechPart, ErrorID, and ErrorMsg
-func (t *SimpleChaincode) setEscalatorState(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+// set the time in seconds after closing a ticket in which a new failure of the same escalator reopens it as a repeat failure.
+func (t *SimpleChaincode) setWarrantyWindow(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Wrong number of arguments, must be 1: warranty window in seconds")
+	}
+	window, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || window < 0 {
+		return nil, errors.New("Warranty window must be a non-negative number of seconds")
+	}
+	return nil, stub.PutState(configKey("warrantyWindow"), []byte(strconv.FormatInt(window, 10)))
+}
+
+//Takes either AssetID and "true" OR AssetID, "false", and 3 more : TechPart, ErrorID, and ErrorMsg
+//The ErrorID must be in the error code catalogue for the asset, see checkErrorID.
+//If the asset already has an open ticket, a failure is attached to it as additional occurrence instead of opening
+//a duplicate. Either way the TicketID is returned.
+//An asset with an open ticket is only set to working if a reason for the override is given as third argument,
+//normally finishing the ticket takes care of that.
+func (t *SimpleChaincode) setAssetState(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) < 2 {
+		return nil, errors.New("Wrong number of arguments, must be at least 2: AssetID and state")
+	}
 
-	var esc Escalator
-	escAsByteArr, err := stub.GetState(args[0])
+	esc, err := getAsset(stub, args[0])
 	if err != nil {
 		return nil, err
 	}
-	json.Unmarshal(escAsByteArr, &esc)
+	if esc.isDecommissioned() {
+		return nil, errors.New("Asset " + args[0] + " is decommissioned")
+	}
 	escState, _ := strconv.ParseBool(args[1])
-	if len(args) == 2 && escState == true {
+	if (len(args) == 2 || len(args) == 3) && escState == true {
+		openTicket, err := findOpenTicket(stub, args[0])
+		if err != nil {
+			return nil, err
+		}
+		if openTicket != nil {
+			if len(args) != 3 || args[2] == "" {
+				return nil, errors.New("Asset " + args[0] + " still has the open ticket " + openTicket.TicketID + ", a reason is needed to set it to working")
+			}
+			openTicket.WorkingOverride = args[2]
+			if err = putTicket(stub, openTicket, "setAssetState"); err != nil {
+				return nil, err
+			}
+		}
 		esc.IsWorking = true
-		escAsByteArr, _ = json.Marshal(esc)
-		stub.PutState(args[0], escAsByteArr)
-		return nil, nil
+		return nil, putAsset(stub, esc, "setAssetState")
 	}
 	if len(args) == 5 && escState == false {
+		if err = checkErrorID(stub, esc, args[3]); err != nil {
+			return nil, err
+		}
+
+		// the ticket is written first, so the asset is left as it is if it cannot be created
+		var ticketID []byte
+		openTicket, err := findOpenTicket(stub, args[0])
+		if err != nil {
+			return nil, err
+		}
+		if openTicket != nil {
+			openTicket.Occurrences = append(openTicket.Occurrences, Occurrence{
+				TechPart:     args[2],
+				ErrorID:      args[3],
+				ErrorMessage: args[4],
+				Time:         getTransactionTime(stub),
+			})
+			if err = putTicket(stub, openTicket, "setAssetState"); err != nil {
+				return nil, err
+			}
+			ticketID = []byte(openTicket.TicketID)
+		} else {
+			ticketArgs := []string{esc.Trainstation, esc.Platform, args[0], args[2], args[3], args[4]}
+			if ticketID, err = t.createTicket(stub, ticketArgs); err != nil {
+				return nil, err
+			}
+		}
 		esc.IsWorking = false
-		escAsByteArr, _ = json.Marshal(esc)
-		stub.PutState(args[0], escAsByteArr)
-		ticketArgs := []string{esc.Trainstation, esc.Platform, args[0], args[2], args[3], args[4]}
-		return t.createTicket(stub, ticketArgs)
+		return ticketID, putAsset(stub, esc, "setAssetState")
 	}
-	return nil, errors.New("Failed to properly set escalator status. Wrong number of arguments ?")
+	return nil, errors.New("Failed to properly set asset status. Wrong number of arguments ?")
 }
 
-// Create a new ticket and store it on the ledger with TicketID as key.
+// Create a new ticket for a registered asset and store it on the ledger with TicketID as key. Returns the TicketID.
+// Arguments are Trainstation, Platform, Device, TechPart, ErrorID and ErrorMessage, or only Trainstation, Platform,
+// Device and ErrorID for an ErrorID from the error code catalogue, which completes the ticket (see completeTicket).
 func (t *SimpleChaincode) createTicket(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) == 4 {
+		args = []string{args[0], args[1], args[2], "", args[3], ""}
+	}
 	if len(args) != 6 {
-		return nil, errors.New("Wrong number of arguments, must be 6: Trainstation, Platform, Device, TechPart, ErrorID and ErrorMessage")
+		return nil, errors.New("Wrong number of arguments, must be 6: Trainstation, Platform, Device, TechPart, ErrorID and ErrorMessage, or 4 without TechPart and ErrorMessage")
+	}
+	station, platform, err := resolveLocation(stub, args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	// the device has to be a registered asset in use, and it can only fail where it is installed
+	esc, err := getAsset(stub, args[2])
+	if err != nil {
+		return nil, err
+	}
+	if esc.StationID != "" && (esc.StationID != station.StationID || esc.PlatformID != platform.PlatformID) {
+		return nil, errors.New("Asset " + esc.AssetID + " is located at " + esc.Trainstation + ", " + esc.Platform +
+			", not at " + station.Name + ", " + platform.Name)
+	}
+	if err = checkTicketDevice(stub, esc, args[4]); err != nil {
+		return nil, err
 	}
 	idAsString, _ := createID(stub, "ticket")
 	time := getTransactionTime(stub)
 	var ticket = Ticket{
 		TicketID:     idAsString,
 		Timestamp:    time,
-		Trainstation: args[0],
-		Platform:     args[1],
+		Trainstation: station.Name,
+		Platform:     platform.Name,
+		StationID:    station.StationID,
+		PlatformID:   platform.PlatformID,
 		Device:       args[2],
-		Status:       "EINGETROFFEN",
+		Status:       statusNew,
 		TechPart:     args[3],
 		ErrorID:      args[4],
 		ErrorMessage: args[5],
 	}
+	if err = completeTicket(stub, &ticket); err != nil {
+		return nil, err
+	}
+	if ticket.TechPart == "" && ticket.ErrorMessage == "" {
+		return nil, errors.New("ErrorID " + ticket.ErrorID + " is not in the error code catalogue, TechPart and ErrorMessage are required")
+	}
 
-	state, err := json.Marshal(ticket)
-
-	stub.PutState(idAsString, state)
+	// a failure shortly after the last repair reopens the last ticket as a repeat failure
+	previous, err := getLastClosedTicket(stub, ticket.Device)
 	if err != nil {
 		return nil, err
 	}
-	return nil, nil
+	if previous != nil && time-previous.FinalRepairTime <= getWarrantyWindowSeconds(stub) {
+		ticket.PreviousTicketID = previous.TicketID
+		ticket.RepeatFailure = true
+	}
+
+	return []byte(ticket.TicketID), putTicket(stub, &ticket, "createTicket")
 }
 
 // Creates a default ticket. This is indeed a necessary comment.
-//
 func (t *SimpleChaincode) createDefaultTicket(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
 
-	var defaultEsc Escalator
-	defaultEscAsByteArr, _ := stub.GetState("DO0001")
-
-	json.Unmarshal(defaultEscAsByteArr, &defaultEsc)
+	defaultEsc, err := getAsset(stub, "DO0001")
+	if err != nil {
+		return nil, err
+	}
+	if defaultEsc.isDecommissioned() {
+		return nil, errors.New("Escalator " + defaultEsc.AssetID + " is decommissioned")
+	}
+	code, err := lookupErrorCode(stub, defaultEsc, defaultErrorCode.ErrorID)
+	if err != nil {
+		return nil, err
+	}
+	if code == nil { // ledger set up before the error code catalogue
+		code = &defaultErrorCode
+	}
 
 	idAsString, _ := createID(stub, "ticket")
 	time := getTransactionTime(stub)
@@ -264,43 +600,23 @@ func (t *SimpleChaincode) createDefaultTicket(stub shim.ChaincodeStubInterface,
 		Timestamp:    time,
 		Trainstation: defaultEsc.Trainstation,
 		Platform:     defaultEsc.Platform,
-		Device:       defaultEsc.EscalatorID,
-		Status:       "Eingetroffen",
-		TechPart:     "Motor RTM-X 64",
-		ErrorID:      "#2356-102",
-		ErrorMessage: "Totalausfall",
-	}
-	state, err := json.Marshal(ticket)
-
-	stub.PutState(idAsString, state)
-	if err != nil {
-		return nil, err
+		StationID:    defaultEsc.StationID,
+		PlatformID:   defaultEsc.PlatformID,
+		Device:       defaultEsc.AssetID,
+		Status:       statusNew,
+		ErrorID:      code.ErrorID,
 	}
-	return nil, nil
+	code.complete(&ticket)
+	return nil, putTicket(stub, &ticket, "createDefaultTicket")
 }
 
-//takes Trainstation and Platform as input
+//takes Trainstation, Platform (registered IDs or names) and optionally the master data as JSON (see updateAsset) as input
+//returns the AssetID of the new escalator
 func (t *SimpleChaincode) createEscalator(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
-	if len(args) != 2 {
-		return nil, errors.New("Wrong number of arguments, must be 2: Trainstation and Platform")
+	if len(args) != 2 && len(args) != 3 {
+		return nil, errors.New("Wrong number of arguments, must be 2 or 3: Trainstation, Platform and optionally master data as JSON")
 	}
-
-	idAsString, _ := createID(stub, "escalator")
-	idAsString = strings.ToUpper(args[0][0:2]) + idAsString //Id is now the first two characters of the location + a sequential ID
-	var escalator = Escalator{
-		EscalatorID:  idAsString,
-		Trainstation: args[0],
-		Platform:     args[1],
-		IsWorking:    true,
-	}
-
-	state, err := json.Marshal(escalator)
-
-	stub.PutState(idAsString, state)
-	if err != nil {
-		return nil, err
-	}
-	return nil, nil
+	return t.createAsset(stub, append([]string{assetTypeEscalator}, args...))
 }
 
 // Assign an existing Ticket to a ServiceProvider. Arguments should be TicketID and the name of the serviceprovider that the ticket gets assigned to.
@@ -309,25 +625,88 @@ func (t *SimpleChaincode) assignTicket(stub shim.ChaincodeStubInterface, args []
 		return nil, errors.New("Wrong number of arguments, must be 2: TicketID and ServiceProvider")
 	}
 
-	var state []byte
-	var err error
-
-	state, err = stub.GetState(args[0]) //get ticket from world state as byte array
+	ticket, err := getTicket(stub, args[0]) //get ticket from world state
 	if err != nil {
 		return nil, err
 	}
-	ticket := new(Ticket)
-	json.Unmarshal(state, &ticket)   // translate back to struct
+	if err = ticket.transition("assignTicket"); err != nil { //update status to "assigned"
+		return nil, err
+	}
 	ticket.ServiceProvider = args[1] //set new  ServiceProvider
-	ticket.Status = "ZUGEWIESEN"     //update status to "assigned"
-	ticket.RepairStatus = "Wird geprueft"
-	state, err = json.Marshal(ticket)
+
+	return nil, putTicket(stub, ticket, "assignTicket") //write updated ticket to world state again
+}
+
+// Reassign a ticket to another ServiceProvider. Arguments are the TicketID, the new ServiceProvider, a reason code from
+// handoverReasons and an optional comment. The handover is recorded on the ticket and the mechanic fields are reset,
+// the completion predicted by the previous provider is kept in the Handover only.
+//
+// The SLA of the ticket is scored in acceptRepair against:
+//   - the provider giving the ticket away, if the reason makes it accountable (PROVIDER_UNAVAILABLE, PROVIDER_FAULT).
+//     The clock keeps running from the ticket creation.
+//   - the new provider otherwise (DISPATCH_ERROR). The clock restarts at the time of the handover.
+//
+// Once a provider is accountable for a ticket, later handovers do not change that.
+func (t *SimpleChaincode) reassignTicket(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 3 && len(args) != 4 {
+		return nil, errors.New("Wrong number of arguments, must be 3 or 4: TicketID, ServiceProvider, reason code and optionally a comment")
+	}
+	reason := strings.ToUpper(args[2])
+	accountable, ok := handoverReasons[reason]
+	if !ok {
+		return nil, errors.New("Unknown handover reason " + args[2] + ", see getHandoverReasons")
+	}
+
+	ticket, err := getTicket(stub, args[0])
 	if err != nil {
 		return nil, err
 	}
-	stub.PutState(args[0], state) //write updated ticket to world state again
+	if strings.EqualFold(ticket.ServiceProvider, args[1]) {
+		return nil, errors.New("Ticket " + ticket.TicketID + " is already assigned to " + ticket.ServiceProvider)
+	}
+	if err = ticket.transition("reassignTicket"); err != nil {
+		return nil, err
+	}
 
-	return nil, nil
+	time := getTransactionTime(stub)
+	handover := Handover{
+		From:          ticket.ServiceProvider,
+		FromEmployee:  ticket.SpEmployee,
+		To:            args[1],
+		Reason:        reason,
+		Time:          time,
+		EstCompletion: ticket.EstCompletion,
+		EtaRevisions:  ticket.EtaRevisions,
+	}
+	if len(args) == 4 {
+		handover.Comment = args[3]
+	}
+	ticket.Handovers = append(ticket.Handovers, handover)
+
+	if ticket.SLAProvider == "" {
+		if accountable {
+			ticket.SLAProvider = ticket.ServiceProvider
+		} else {
+			ticket.SLAStart = time
+			ticket.PausedDuration = 0
+		}
+	}
+
+	ticket.ServiceProvider = args[1]
+	ticket.SpEmployee = ""
+	ticket.SpeCommentary = ""
+	ticket.EstRepairTime = ""
+	ticket.TimeOfArrival = 0
+	// the new provider writes its own report, the parts of this one stay booked against the previous provider
+	ticket.Report = nil
+	ticket.FinalReport = ""
+	ticket.EstCompletion = 0
+	ticket.EtaRevisions = nil
+	ticket.ArrivalPosition = nil
+	ticket.ArrivalDistance = 0
+	ticket.ArrivalCheck = ""
+
+	return nil, putTicket(stub, ticket, "reassignTicket")
 }
 
 func (t *SimpleChaincode) startJourney(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
@@ -335,154 +714,254 @@ func (t *SimpleChaincode) startJourney(stub shim.ChaincodeStubInterface, args []
 		return nil, errors.New("Wrong number of arguments, must be 1: TicketID")
 	}
 
-	var state []byte
-	var err error
-	state, err = stub.GetState(args[0])
+	ticket, err := getTicket(stub, args[0])
 	if err != nil {
 		return nil, err
 	}
-
-	ticket := new(Ticket)
-	json.Unmarshal(state, &ticket)
-	ticket.RepairStatus = "Techniker in Anfahrt"
-	state, err = json.Marshal(ticket)
-	if err != nil {
+	if err = ticket.transition("startJourney"); err != nil {
 		return nil, err
 	}
-	stub.PutState(args[0], state) //write updated ticket to world state again
 
-	return nil, nil
+	return nil, putTicket(stub, ticket, "startJourney") //write updated ticket to world state again
 }
 
 func (t *SimpleChaincode) onArrival(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
-	if len(args) != 3 {
-		return nil, errors.New("Wrong number of arguments, must be 2: TicketID,SpeCommentary and EstRepairTime")
+	if len(args) != 3 && len(args) != 5 {
+		return nil, errors.New("Wrong number of arguments, must be 3 or 5: TicketID,SpeCommentary, EstRepairTime and optionally latitude and longitude of the mechanic")
 	}
-
-	var state []byte
-	var err error
-
-	state, err = stub.GetState(args[0])
+	estRepairTime, err := parseRepairDuration(args[2])
 	if err != nil {
 		return nil, err
 	}
+	var position *Position
+	if len(args) == 5 {
+		if position, err = parsePosition(args[3], args[4]); err != nil {
+			return nil, err
+		}
+	}
 
-	ticket := new(Ticket)
-	json.Unmarshal(state, &ticket)
+	ticket, err := getTicket(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if err = ticket.transition("onArrival"); err != nil {
+		return nil, err
+	}
 	ticket.TimeOfArrival = getTransactionTime(stub)
 	ticket.SpeCommentary = args[1]
 	ticket.EstRepairTime = args[2]
-	ticket.RepairStatus = "Techniker vor Ort"
-	state, err = json.Marshal(ticket)
-	if err != nil {
+	ticket.EstCompletion = ticket.TimeOfArrival + estRepairTime
+	if err = verifyArrival(stub, ticket, position); err != nil {
 		return nil, err
 	}
-	stub.PutState(args[0], state) //write updated ticket to world state again
+	if len(args[1]) > 0 {
+		if err = ticket.appendComment(stub, roleMechanic, visibilityShared, args[1]); err != nil {
+			return nil, err
+		}
+	}
 
-	return nil, nil
+	return nil, putTicket(stub, ticket, "onArrival") //write updated ticket to world state again
 }
 func (t *SimpleChaincode) startRepair(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
 	if len(args) != 1 {
 		return nil, errors.New("Wrong number of arguments, must be 1: TicketID")
 	}
 
-	var state []byte
-	var err error
-
-	state, err = stub.GetState(args[0])
+	ticket, err := getTicket(stub, args[0])
 	if err != nil {
 		return nil, err
 	}
-
-	ticket := new(Ticket)
-	json.Unmarshal(state, &ticket)
-	ticket.RepairStatus = "Reparatur begonnen"
-	state, err = json.Marshal(ticket)
-	if err != nil {
+	if err = ticket.transition("startRepair"); err != nil {
 		return nil, err
 	}
-	stub.PutState(args[0], state) //write updated ticket to world state again
 
-	return nil, nil
+	return nil, putTicket(stub, ticket, "startRepair") //write updated ticket to world state again
 }
 
+// The service provider reports the repair as finished. This stops the SLA clock, the ticket is closed once the station
+// operator accepts the repair with acceptRepair. Input is the TicketID.
 func (t *SimpleChaincode) finishRepair(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
 	if len(args) != 1 {
 		return nil, errors.New("Wrong number of arguments, must be 1: TicketID")
 	}
 
-	state, err := stub.GetState(args[0])
+	ticket, err := getTicket(stub, args[0])
 	if err != nil {
 		return nil, err
 	}
-
-	ticket := new(Ticket)
-	json.Unmarshal(state, &ticket)
+	if err = ticket.transition("finishRepair"); err != nil {
+		return nil, err
+	}
 	ticket.FinalRepairTime = getTransactionTime(stub)
-	ticket.RepairStatus = "Reparatur abgeschlossen"
-	ticket.Status = "ERLEDIGT"
-	state, err = json.Marshal(ticket)
+
+	return nil, putTicket(stub, ticket, "finishRepair") //write updated ticket to world state again
+}
+
+// The station operator confirms that the escalator works after the repair and closes the ticket. Arguments are the
+// TicketID and optionally a comment. The SLA is evaluated with the time the provider finished the repair, maintenance
+// tickets are checked against their due date instead.
+func (t *SimpleChaincode) acceptRepair(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, errors.New("Wrong number of arguments, must be 1 or 2: TicketID and optionally a comment")
+	}
+
+	ticket, err := getTicket(stub, args[0])
 	if err != nil {
 		return nil, err
 	}
-	stub.PutState(args[0], state) //write updated ticket to world state again
+	if err = ticket.transition("acceptRepair"); err != nil {
+		return nil, err
+	}
+	// a pause decided after the evaluation would not count anymore
+	if ticket.hasPendingPause() {
+		return nil, errors.New("Ticket " + ticket.TicketID + " has pauses that are not decided yet, see decidePause")
+	}
+	ticket.AcceptedBy = getCaller(stub)
+	ticket.AcceptedAt = getTransactionTime(stub)
+	if len(args) == 2 {
+		ticket.AcceptComment = args[1]
+	}
+	if ticket.isPlanned() {
+		if err = checkDueDate(stub, ticket); err != nil {
+			return nil, err
+		}
+		if err = putTicket(stub, ticket, "acceptRepair"); err != nil {
+			return nil, err
+		}
+		return nil, chargeRepairCosts(stub, ticket)
+	}
 
 	//update SLA depending on timestamps
-	var sla ServiceLevelAgreement
-	slaAsByteArr, _ := stub.GetState("sla" + strings.ToLower(ticket.ServiceProvider))
-	json.Unmarshal(slaAsByteArr, &sla)
+	sla, err := getServiceLevelAgreement(stub, ticket.scoredProvider())
+	if err != nil {
+		return nil, err
+	}
+	ticket.SLAResult = evaluateSLA(ticket, sla)
+	sla.count(ticket.SLAResult, 1)
+	if err = putServiceLevelAgreement(stub, sla); err != nil {
+		return nil, err
+	}
+	if err = putTicket(stub, ticket, "acceptRepair"); err != nil { //write updated ticket to world state again
+		return nil, err
+	}
+	if err = chargeRepairCosts(stub, ticket); err != nil {
+		return nil, err
+	}
+	if err = chargeSLAPenalty(stub, ticket, ticket.SLAResult); err != nil {
+		return nil, err
+	}
 
-	ttA := ticket.TimeOfArrival - ticket.Timestamp   //time to arrive
-	ttR := ticket.FinalRepairTime - ticket.Timestamp //time to repair
-	switch {
-	case (ttA < sla.TimeToArrive) && (ttR < sla.TimeToRepair): //All good
-		sla.None += 1
-	case (ttA > sla.TimeToArrive+10800) || (ttR > sla.TimeToRepair+14400): //mechanic arrived more than 10800s = 3hours late OR it took more than 4 hours longer to repair overall
-		sla.Severe += 1
-	default:
-		sla.Light += 1
+	if ticket.RepeatFailure {
+		if err = countRepeatFailure(stub, ticket.PreviousTicketID); err != nil {
+			return nil, err
+		}
 	}
+	return nil, restoreAssetState(stub, ticket.Device)
+}
 
-	slaAsByteArr, _ = json.Marshal(sla)
-	stub.PutState("sla"+strings.ToLower(ticket.ServiceProvider), slaAsByteArr)
-	return nil, nil
+// The station operator does not accept the repair, e.g. because the escalator still does not work. Arguments are the
+// TicketID and the reason. The ticket returns to the service provider with the repair in progress and the SLA clock
+// running again from the original start.
+func (t *SimpleChaincode) rejectRepair(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 2 || args[1] == "" {
+		return nil, errors.New("Wrong number of arguments, must be 2: TicketID and reason")
+	}
+
+	ticket, err := getTicket(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if err = ticket.transition("rejectRepair"); err != nil {
+		return nil, err
+	}
+	ticket.Rejections = append(ticket.Rejections, Rejection{
+		Reason:          args[1],
+		RejectedBy:      getCaller(stub),
+		Time:            getTransactionTime(stub),
+		FinalRepairTime: ticket.FinalRepairTime,
+	})
+	ticket.FinalRepairTime = 0
+
+	return nil, putTicket(stub, ticket, "rejectRepair")
 }
 
-func (t *SimpleChaincode) writeFinalReport(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
-	if len(args) != 2 {
-		return nil, errors.New("Wrong number of arguments, must be 2: TicketID and final commentary")
+// Cancel an open ticket that turned out to be a false alarm, a duplicate or a mistake. Arguments are the TicketID, a
+// reason code from cancelReasons and an optional comment. A finished repair can no longer be cancelled, the station
+// operator accepts or rejects it. The escalator is set to working again unless another ticket for it is still open.
+// Cancelled tickets are never evaluated against any SLA, cancelled maintenance tickets count as missed on their plan.
+func (t *SimpleChaincode) cancelTicket(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, errors.New("Wrong number of arguments, must be 2 or 3: TicketID, reason code and optionally a comment")
+	}
+	reason := strings.ToUpper(args[1])
+	if _, ok := cancelReasons[reason]; !ok {
+		return nil, errors.New("Unknown cancel reason " + args[1] + ", see getCancelReasons")
+	}
+
+	ticket, err := getTicket(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if err = ticket.transition("cancelTicket"); err != nil {
+		return nil, err
+	}
+	ticket.CancelReason = reason
+	if len(args) == 3 {
+		ticket.CancelComment = args[2]
+	}
+	if ticket.isPlanned() {
+		if err = checkDueDate(stub, ticket); err != nil {
+			return nil, err
+		}
+		return nil, putTicket(stub, ticket, "cancelTicket")
+	}
+	if err = putTicket(stub, ticket, "cancelTicket"); err != nil {
+		return nil, err
 	}
 
-	var state []byte
-	var err error
+	return nil, restoreAssetState(stub, ticket.Device)
+}
 
-	state, err = stub.GetState(args[0])
+// Submit the final report of a repair. Arguments are the TicketID and the report as JSON encoded RepairReport, e.g.
+// {"RootCause":"WEAR","PartsReplaced":[{"PartNumber":"RTM-X 64","Quantity":1,"Depot":"Dortmund"}],
+// "Labour":[{"Mechanic":"Hans","Hours":2.5}],"FollowUpRequired":false,"Text":"motor replaced"}
+// The report may be submitted again to correct it until the repair is finished. Replaced parts are booked out of the
+// given depot of the ServiceProvider right away, so they have to be in stock there.
+func (t *SimpleChaincode) writeFinalReport(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 2 {
+		return nil, errors.New("Wrong number of arguments, must be 2: TicketID and final report")
+	}
+	report, err := parseRepairReport(args[1])
 	if err != nil {
 		return nil, err
 	}
-	ticket := new(Ticket)
-	json.Unmarshal(state, &ticket)
-	ticket.FinalReport = args[1]
-	ticket.RepairStatus = "Im Abschluss"
-	state, err = json.Marshal(ticket)
+
+	ticket, err := getTicket(stub, args[0])
 	if err != nil {
 		return nil, err
 	}
-	stub.PutState(args[0], state) //write updated ticket to world state again
+	if err = ticket.transition("writeFinalReport"); err != nil {
+		return nil, err
+	}
+	if err = consumeReplacedParts(stub, ticket, report); err != nil {
+		return nil, err
+	}
+	ticket.Report = report
+	ticket.FinalReport = report.Text
 
-	return nil, nil
+	return nil, putTicket(stub, ticket, "writeFinalReport") //write updated ticket to world state again
 }
 
 //..............................................
 //............QUERY FUNCTIONS..................
 //..............................................
 
-func (t *SimpleChaincode) getEscalatorState(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
-	escAsByteArr, err := stub.GetState(args[0])
+func (t *SimpleChaincode) getAssetState(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	escAsByteArr, err := stub.GetState(assetKey(args[0]))
 	if err != nil {
 		return nil, err
 	}
-	var esc Escalator
+	var esc Asset
 	json.Unmarshal(escAsByteArr, &esc)
 	var byteArr []byte
 	return strconv.AppendBool(byteArr, esc.IsWorking), nil
@@ -492,15 +971,29 @@ func (t *SimpleChaincode) getEscalatorState(stub shim.ChaincodeStubInterface, ar
 //Input should be the name of the serviceprovider
 func (t *SimpleChaincode) getSLA(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
 
-	slaAsByteArr, err := stub.GetState("sla" + strings.ToLower(args[0]))
+	slaAsByteArr, err := stub.GetState(slaKey(args[0]))
 	if err != nil {
 		return nil, err
 	}
 	return slaAsByteArr, nil
 }
 
+func (t *SimpleChaincode) getWarrantyWindow(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	return []byte(strconv.FormatInt(getWarrantyWindowSeconds(stub), 10)), nil
+}
+
+// returns the catalogue of reason codes accepted by reassignTicket, together with whether the previous provider stays accountable
+func (t *SimpleChaincode) getHandoverReasons(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	return json.Marshal(handoverReasons)
+}
+
+// returns the catalogue of reason codes accepted by cancelTicket
+func (t *SimpleChaincode) getCancelReasons(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	return json.Marshal(cancelReasons)
+}
+
 func (t *SimpleChaincode) getTicketCounter(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
-	ticketCounterAsByteArr, err := stub.GetState("ticketCounter")
+	ticketCounterAsByteArr, err := stub.GetState(counterKey("ticket"))
 	if err != nil {
 		return nil, err
 	}
@@ -512,7 +1005,7 @@ func (t *SimpleChaincode) getFullTicket(stub shim.ChaincodeStubInterface, args [
 		return nil, errors.New("Wrong number of arguments. Must be (1): TicketID")
 	}
 
-	ticketAsByteArr, err := stub.GetState(args[0])
+	ticketAsByteArr, err := stub.GetState(ticketKey(args[0]))
 
 	if err != nil {
 		return nil, errors.New("Query failure for getFullTicket")
@@ -523,9 +1016,8 @@ func (t *SimpleChaincode) getFullTicket(stub shim.ChaincodeStubInterface, args [
 
 func (t *SimpleChaincode) getTicketsByServiceProvider(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
 	//construct iterator
-	startKey := "0001"
-	MaxIdAsBytes, _ := stub.GetState("ticketCounter")
-	endKey := string(MaxIdAsBytes[:])
+	startKey := ticketPrefix
+	endKey := ticketPrefix + "~"
 
 	resultsIterator, err := stub.RangeQueryState(startKey, endKey)
 	if err != nil {
@@ -567,14 +1059,13 @@ func (t *SimpleChaincode) getTicketsByServiceProvider(stub shim.ChaincodeStubInt
 	return buffer.Bytes(), nil
 }
 
-//returns a collection of Tickets with a given Status. Expects either "EINGETROFFEN", "ZUGEWIESEN", or "ERLEDIGT" as first input argument.
+//returns a collection of Tickets with a given Status. Expects either "EINGETROFFEN", "ZUGEWIESEN", "ERLEDIGT" or "STORNIERT" as first input argument.
 //OPTIONAL : Add ServiceProvider String as 2nd argument.
 func (t *SimpleChaincode) getTicketsByStatus(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
 
 	//construct iterator
-	startKey := "0001"
-	MaxIdAsBytes, _ := stub.GetState("ticketCounter")
-	endKey := string(MaxIdAsBytes[:])
+	startKey := ticketPrefix
+	endKey := ticketPrefix + "~"
 
 	resultsIterator, err := stub.RangeQueryState(startKey, endKey)
 	if err != nil {
@@ -649,9 +1140,8 @@ func (t *SimpleChaincode) getTicketsByMechanic(stub shim.ChaincodeStubInterface,
 	}
 
 	//construct iterator
-	startKey := "0001"
-	MaxIdAsBytes, _ := stub.GetState("ticketCounter")
-	endKey := string(MaxIdAsBytes[:])
+	startKey := ticketPrefix
+	endKey := ticketPrefix + "~"
 
 	resultsIterator, err := stub.RangeQueryState(startKey, endKey)
 	if err != nil {
@@ -697,9 +1187,8 @@ func (t *SimpleChaincode) getTicketsByMechanic(stub shim.ChaincodeStubInterface,
 // Takes a ServiceProvider string as input.
 func (t *SimpleChaincode) getWIPTickets(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
 	//construct iterator
-	startKey := "0001"
-	MaxIdAsBytes, _ := stub.GetState("ticketCounter")
-	endKey := string(MaxIdAsBytes[:])
+	startKey := ticketPrefix
+	endKey := ticketPrefix + "~"
 
 	resultsIterator, err := stub.RangeQueryState(startKey, endKey)
 	if err != nil {
@@ -725,7 +1214,7 @@ func (t *SimpleChaincode) getWIPTickets(stub shim.ChaincodeStubInterface, args [
 
 		// check if ticket has given ServiceProvider
 		if strings.EqualFold(tempTicket.ServiceProvider, args[0]) &&
-			(strings.EqualFold(tempTicket.RepairStatus, "Reparatur begonnen") || strings.EqualFold(tempTicket.RepairStatus, "Techniker vor Ort") || strings.EqualFold(tempTicket.RepairStatus, "Im Abschluss")) {
+			(strings.EqualFold(tempTicket.RepairStatus, repairStarted) || strings.EqualFold(tempTicket.RepairStatus, repairOnSite) || strings.EqualFold(tempTicket.RepairStatus, repairReporting)) {
 			// Add a comma before array members, suppress it for the first array member
 			if bArrayMemberAlreadyWritten == true {
 				buffer.WriteString(",")
@@ -742,9 +1231,8 @@ func (t *SimpleChaincode) getWIPTickets(stub shim.ChaincodeStubInterface, args [
 }
 
 func (t *SimpleChaincode) getNewSPTickets(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
-	startKey := "0001"
-	MaxIdAsBytes, _ := stub.GetState("ticketCounter")
-	endKey := string(MaxIdAsBytes[:])
+	startKey := ticketPrefix
+	endKey := ticketPrefix + "~"
 
 	resultsIterator, err := stub.RangeQueryState(startKey, endKey)
 	if err != nil {
@@ -769,7 +1257,7 @@ func (t *SimpleChaincode) getNewSPTickets(stub shim.ChaincodeStubInterface, args
 		json.Unmarshal(queryResultValue, &tempTicket)
 
 		// check if ticket has given ServiceProvider
-		if strings.EqualFold(tempTicket.ServiceProvider, args[0]) && strings.EqualFold(tempTicket.RepairStatus, "Wird geprueft") {
+		if strings.EqualFold(tempTicket.ServiceProvider, args[0]) && strings.EqualFold(tempTicket.RepairStatus, repairChecking) {
 
 			// Add a comma before array members, suppress it for the first array member
 			if bArrayMemberAlreadyWritten == true {
@@ -789,9 +1277,8 @@ func (t *SimpleChaincode) getNewSPTickets(stub shim.ChaincodeStubInterface, args
 // Returns Tickets for a given ServiceProvider that have been assigned to a Mechanic that has not yet had a look at the broken device
 func (t *SimpleChaincode) getAssignedSPTickets(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
 	//construct iterator
-	startKey := "0001"
-	MaxIdAsBytes, _ := stub.GetState("ticketCounter")
-	endKey := string(MaxIdAsBytes[:])
+	startKey := ticketPrefix
+	endKey := ticketPrefix + "~"
 
 	resultsIterator, err := stub.RangeQueryState(startKey, endKey)
 	if err != nil {
@@ -817,7 +1304,7 @@ func (t *SimpleChaincode) getAssignedSPTickets(stub shim.ChaincodeStubInterface,
 
 		// check if ticket has given ServiceProvider
 		if strings.EqualFold(tempTicket.ServiceProvider, args[0]) &&
-			(strings.EqualFold(tempTicket.RepairStatus, "Techniker in Anfahrt") || strings.EqualFold(tempTicket.RepairStatus, "Ticket erhalten")) {
+			(strings.EqualFold(tempTicket.RepairStatus, repairOnTheWay) || strings.EqualFold(tempTicket.RepairStatus, repairMechanicAssigned)) {
 
 			// Add a comma before array members, suppress it for the first array member
 			if bArrayMemberAlreadyWritten == true {
@@ -834,13 +1321,14 @@ func (t *SimpleChaincode) getAssignedSPTickets(stub shim.ChaincodeStubInterface,
 	return buffer.Bytes(), nil
 }
 
+// returns the tickets from the first to the second TicketID (both included)
 func (t *SimpleChaincode) getTicketsByRange(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
 	if len(args) != 2 {
 		return nil, errors.New("Incorrect number of arguments. Expecting 2")
 	}
 
-	startKey := args[0]
-	endKey := args[1]
+	startKey := ticketKey(args[0])
+	endKey := ticketKey(args[1])
 
 	resultsIterator, err := stub.RangeQueryState(startKey, endKey)
 	if err != nil {
@@ -874,13 +1362,7 @@ func (t *SimpleChaincode) getTicketsByRange(stub shim.ChaincodeStubInterface, ar
 }
 
 func (t *SimpleChaincode) getAllTickets(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
-	ticketCounterAsByteArr, err := stub.GetState("ticketCounter")
-	s := string(ticketCounterAsByteArr[:])
-	if err != nil {
-		return nil, err
-	}
-
-	return t.getTicketsByRange(stub, []string{"0001", s})
+	return getRangeAsJSONArray(stub, ticketPrefix, ticketPrefix+"~")
 }
 
 func (t *SimpleChaincode) assignMechanic(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
@@ -888,25 +1370,16 @@ func (t *SimpleChaincode) assignMechanic(stub shim.ChaincodeStubInterface, args
 		return nil, errors.New("Wrong number of arguments, must be 2: TicketID and SpEmployee ")
 	}
 
-	var state []byte
-	var err error
-
-	state, err = stub.GetState(args[0])
+	ticket, err := getTicket(stub, args[0])
 	if err != nil {
 		return nil, err
 	}
-
-	ticket := new(Ticket)
-	json.Unmarshal(state, &ticket)
-	ticket.SpEmployee = args[1]
-	ticket.RepairStatus = "Ticket erhalten"
-	state, err = json.Marshal(ticket)
-	if err != nil {
+	if err = ticket.transition("assignMechanic"); err != nil {
 		return nil, err
 	}
-	stub.PutState(args[0], state) //write updated ticket to world state again
+	ticket.SpEmployee = args[1]
 
-	return nil, nil
+	return nil, putTicket(stub, ticket, "assignMechanic") //write updated ticket to world state again
 }
 
 //..............................................
@@ -919,28 +1392,428 @@ func getTransactionTime(stub shim.ChaincodeStubInterface) int64 {
 
 }
 
+// leftPad2Len pads s to overallLen with padStr. Strings that are already long enough are returned unchanged.
 func leftPad2Len(s string, padStr string, overallLen int) string {
+	if len(s) >= overallLen {
+		return s
+	}
 	var padCountInt int
 	padCountInt = 1 + ((overallLen - len(padStr)) / len(padStr))
 	var retStr = strings.Repeat(padStr, padCountInt) + s
 	return retStr[(len(retStr) - overallLen):]
 }
 
-func getEscalatorAsByteArr(stub shim.ChaincodeStubInterface, escalatorID string) ([]byte, error) {
-	return stub.GetState(escalatorID)
+// getTicket reads the Ticket with the given TicketID from the world state.
+func getTicket(stub shim.ChaincodeStubInterface, ticketID string) (*Ticket, error) {
+	state, err := stub.GetState(ticketKey(ticketID))
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return nil, errors.New("No ticket found for TicketID " + ticketID)
+	}
+	ticket := new(Ticket)
+	if err = json.Unmarshal(state, ticket); err != nil {
+		return nil, err
+	}
+	return ticket, nil
+}
+
+// putTicket writes the Ticket to the world state under its ticketKey and records the changes made by action in the
+// ticket's history. It also keeps the list of open tickets of the device up to date.
+func putTicket(stub shim.ChaincodeStubInterface, ticket *Ticket, action string) error {
+	oldState, err := stub.GetState(ticketKey(ticket.TicketID))
+	if err != nil {
+		return err
+	}
+	state, err := json.Marshal(ticket)
+	if err != nil {
+		return err
+	}
+	if err = recordTicketEvent(stub, ticket.TicketID, action, oldState, state); err != nil {
+		return err
+	}
+	wasOpen := false
+	if oldState != nil {
+		var old Ticket
+		if err = json.Unmarshal(oldState, &old); err != nil {
+			return err
+		}
+		wasOpen = old.isOpen()
+	}
+	if wasOpen != ticket.isOpen() {
+		if err = updateOpenTickets(stub, ticket, ticket.isOpen()); err != nil {
+			return err
+		}
+	}
+	return stub.PutState(ticketKey(ticket.TicketID), state)
+}
+
+// getRangeAsJSONArray returns the values of all keys from startKey to endKey as JSON array.
+func getRangeAsJSONArray(stub shim.ChaincodeStubInterface, startKey string, endKey string) ([]byte, error) {
+	resultsIterator, err := stub.RangeQueryState(startKey, endKey)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	// buffer is a JSON array containing QueryResults
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+
+	bArrayMemberAlreadyWritten := false
+	for resultsIterator.HasNext() {
+		_, queryResultValue, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		// Add a comma before array members, suppress it for the first array member
+		if bArrayMemberAlreadyWritten == true {
+			buffer.WriteString(",")
+		}
+		buffer.Write(queryResultValue)
+		bArrayMemberAlreadyWritten = true
+	}
+	buffer.WriteString("]")
+
+	return buffer.Bytes(), nil
+}
+
+// forEachInRange calls f with the value of every key from startKey to endKey.
+func forEachInRange(stub shim.ChaincodeStubInterface, startKey string, endKey string, f func(value []byte) error) error {
+	resultsIterator, err := stub.RangeQueryState(startKey, endKey)
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		_, queryResultValue, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+		if err = f(queryResultValue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nextSequence increments the counter stored under counterKey and returns its new value.
+func nextSequence(stub shim.ChaincodeStubInterface, counterKey string) (int64, error) {
+	counterAsBytes, err := stub.GetState(counterKey)
+	if err != nil {
+		return 0, err
+	}
+	seq, _ := strconv.ParseInt(string(counterAsBytes), 10, 64)
+	seq++
+	return seq, stub.PutState(counterKey, []byte(strconv.FormatInt(seq, 10)))
+}
+
+// getTickets returns all tickets on the ledger, ordered by TicketID.
+func getTickets(stub shim.ChaincodeStubInterface) ([]Ticket, error) {
+	startKey := ticketPrefix
+	endKey := ticketPrefix + "~"
+
+	resultsIterator, err := stub.RangeQueryState(startKey, endKey)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var tickets []Ticket
+	for resultsIterator.HasNext() {
+		_, queryResultValue, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var ticket Ticket
+		if err = json.Unmarshal(queryResultValue, &ticket); err != nil {
+			return nil, err
+		}
+		tickets = append(tickets, ticket)
+	}
+	return tickets, nil
+}
+
+// getLastClosedTicket returns the most recently closed fault ticket for the given device, or nil if there is none.
+func getLastClosedTicket(stub shim.ChaincodeStubInterface, device string) (*Ticket, error) {
+	tickets, err := getTickets(stub)
+	if err != nil {
+		return nil, err
+	}
+	var last *Ticket
+	for i := range tickets {
+		if tickets[i].Device != device || tickets[i].isPlanned() || !strings.EqualFold(tickets[i].Status, statusDone) {
+			continue
+		}
+		if last == nil || tickets[i].FinalRepairTime >= last.FinalRepairTime {
+			last = &tickets[i]
+		}
+	}
+	return last, nil
+}
+
+// hasOpenTicket reports whether there is a fault ticket for the given device that is neither finished nor cancelled.
+func hasOpenTicket(stub shim.ChaincodeStubInterface, device string) (bool, error) {
+	ticket, err := findOpenTicket(stub, device)
+	return ticket != nil, err
+}
+
+// findOpenTicket returns the oldest fault ticket for the given device that is neither finished nor cancelled, or nil
+// if there is none. Open maintenance tickets do not mean the device is broken.
+func findOpenTicket(stub shim.ChaincodeStubInterface, device string) (*Ticket, error) {
+	return findOpenTicketOfKind(stub, device, kindFault)
+}
+
+// findOpenTicketOfKind is findOpenTicket for tickets of the given Kind.
+func findOpenTicketOfKind(stub shim.ChaincodeStubInterface, device string, kind string) (*Ticket, error) {
+	ticketIDs, err := getOpenTicketIDs(stub, device)
+	if err != nil {
+		return nil, err
+	}
+	for _, ticketID := range ticketIDs {
+		ticket, err := getTicket(stub, ticketID)
+		if err != nil {
+			return nil, err
+		}
+		if ticket.Kind == kind {
+			return ticket, nil
+		}
+	}
+	return nil, nil
+}
+
+// getOpenTicketIDs returns the IDs of the open tickets of a device in order of creation. The list is kept up to date
+// by putTicket, so unlike a range query over the tickets it includes the changes of the current transaction.
+func getOpenTicketIDs(stub shim.ChaincodeStubInterface, device string) ([]string, error) {
+	idsAsByteArr, err := stub.GetState(openTicketsKey(device))
+	if err != nil || idsAsByteArr == nil {
+		return nil, err
+	}
+	var ticketIDs []string
+	if err = json.Unmarshal(idsAsByteArr, &ticketIDs); err != nil {
+		return nil, err
+	}
+	return ticketIDs, nil
+}
+
+// updateOpenTickets adds the ticket to or removes it from the list of open tickets of its device.
+func updateOpenTickets(stub shim.ChaincodeStubInterface, ticket *Ticket, open bool) error {
+	ticketIDs, err := getOpenTicketIDs(stub, ticket.Device)
+	if err != nil {
+		return err
+	}
+	updated := []string{}
+	for _, ticketID := range ticketIDs {
+		if ticketID != ticket.TicketID {
+			updated = append(updated, ticketID)
+		}
+	}
+	if open {
+		updated = append(updated, ticket.TicketID)
+	}
+	if len(updated) == 0 {
+		return stub.DelState(openTicketsKey(ticket.Device))
+	}
+	idsAsByteArr, err := json.Marshal(updated)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(openTicketsKey(ticket.Device), idsAsByteArr)
+}
+
+func openTicketsKey(device string) string {
+	return "openTickets/" + device
+}
+
+// restoreAssetState sets the asset to working after one of its tickets was closed, unless it is still broken
+// according to another open ticket.
+func restoreAssetState(stub shim.ChaincodeStubInterface, assetID string) error {
+	stillBroken, err := hasOpenTicket(stub, assetID)
+	if err != nil || stillBroken {
+		return err
+	}
+	esc, err := findAsset(stub, assetID)
+	if err != nil || esc == nil || esc.isDecommissioned() {
+		// tickets created before createTicket required a registered asset may name any device
+		return err
+	}
+	esc.IsWorking = true
+	return putAsset(stub, esc, "restoreAssetState")
+}
+
+func getWarrantyWindowSeconds(stub shim.ChaincodeStubInterface) int64 {
+	windowAsBytes, err := stub.GetState(configKey("warrantyWindow"))
+	if err != nil || windowAsBytes == nil {
+		return defaultWarrantyWindow
+	}
+	window, err := strconv.ParseInt(string(windowAsBytes), 10, 64)
+	if err != nil {
+		return defaultWarrantyWindow
+	}
+	return window
+}
+
+func getServiceLevelAgreement(stub shim.ChaincodeStubInterface, serviceProvider string) (*ServiceLevelAgreement, error) {
+	slaAsByteArr, err := stub.GetState(slaKey(serviceProvider))
+	if err != nil {
+		return nil, err
+	}
+	if slaAsByteArr == nil {
+		return nil, errors.New("No SLA found for service provider " + serviceProvider)
+	}
+	sla := new(ServiceLevelAgreement)
+	if err = json.Unmarshal(slaAsByteArr, sla); err != nil {
+		return nil, err
+	}
+	return sla, nil
+}
+
+func putServiceLevelAgreement(stub shim.ChaincodeStubInterface, sla *ServiceLevelAgreement) error {
+	slaAsByteArr, err := json.Marshal(sla)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(slaKey(sla.ServiceProvider), slaAsByteArr)
+}
+
+// scoredProvider returns the service provider whose SLA the ticket is evaluated against.
+func (ticket *Ticket) scoredProvider() string {
+	if ticket.SLAProvider != "" {
+		return ticket.SLAProvider
+	}
+	return ticket.ServiceProvider
+}
+
+// slaStart returns the time the SLA clock of the ticket started.
+func (ticket *Ticket) slaStart() int64 {
+	if ticket.SLAStart != 0 {
+		return ticket.SLAStart
+	}
+	return ticket.Timestamp
+}
+
+// evaluateSLA compares the arrival and repair times of a finished ticket with the agreed times of the SLA. Approved
+// pauses do not count towards either time.
+func evaluateSLA(ticket *Ticket, sla *ServiceLevelAgreement) string {
+	start := ticket.slaStart()
+	ttA := ticket.TimeOfArrival - start - ticket.pausedBetween(start, ticket.TimeOfArrival)     //time to arrive
+	ttR := ticket.FinalRepairTime - start - ticket.pausedBetween(start, ticket.FinalRepairTime) //time to repair
+	switch {
+	case (ttA < sla.TimeToArrive) && (ttR < sla.TimeToRepair): //All good
+		return slaNone
+	case (ttA > sla.TimeToArrive+severeArrivalDelay) || (ttR > sla.TimeToRepair+severeRepairDelay): //mechanic arrived more than 10800s = 3hours late OR it took more than 4 hours longer to repair overall
+		return slaSevere
+	default:
+		return slaLight
+	}
+}
+
+// count adds delta to the counter of the SLA that belongs to result.
+func (sla *ServiceLevelAgreement) count(result string, delta int64) {
+	switch result {
+	case slaNone:
+		sla.None += delta
+	case slaLight:
+		sla.Light += delta
+	case slaSevere:
+		sla.Severe += delta
+	}
+}
+
+// countRepeatFailure counts a repeat failure against the provider that repaired the previous ticket. A repair that
+// was scored without violation is downgraded to a light violation, as it did not last.
+func countRepeatFailure(stub shim.ChaincodeStubInterface, previousTicketID string) error {
+	previous, err := getTicket(stub, previousTicketID)
+	if err != nil {
+		return err
+	}
+	sla, err := getServiceLevelAgreement(stub, previous.scoredProvider())
+	if err != nil {
+		return err
+	}
+	sla.RepeatFailures++
+	if previous.SLAResult == slaNone {
+		sla.count(slaNone, -1)
+		sla.count(slaLight, 1)
+		previous.SLAResult = slaLight
+		if err = putTicket(stub, previous, "countRepeatFailure"); err != nil {
+			return err
+		}
+		if err = chargeSLAPenalty(stub, previous, slaLight); err != nil {
+			return err
+		}
+	}
+	return putServiceLevelAgreement(stub, sla)
+}
+
+func getAssetAsByteArr(stub shim.ChaincodeStubInterface, assetID string) ([]byte, error) {
+	return stub.GetState(assetKey(assetID))
+}
+
+// getAsset reads the Asset with the given AssetID from the world state.
+func getAsset(stub shim.ChaincodeStubInterface, assetID string) (*Asset, error) {
+	esc, err := findAsset(stub, assetID)
+	if err == nil && esc == nil {
+		err = errors.New("No asset found for AssetID " + assetID)
+	}
+	return esc, err
+}
+
+// findAsset is like getAsset, but returns nil without an error if there is no such asset.
+func findAsset(stub shim.ChaincodeStubInterface, assetID string) (*Asset, error) {
+	escAsByteArr, err := getAssetAsByteArr(stub, assetID)
+	if err != nil || escAsByteArr == nil {
+		return nil, err
+	}
+	esc := new(Asset)
+	if err = json.Unmarshal(escAsByteArr, esc); err != nil {
+		return nil, err
+	}
+	return esc, nil
+}
+
+// putAsset writes the Asset to the world state under its assetKey. If action changes whether the asset is working, the
+// change is appended to the asset's state log.
+func putAsset(stub shim.ChaincodeStubInterface, esc *Asset, action string) error {
+	old, err := getAssetAsByteArr(stub, esc.AssetID)
+	if err != nil {
+		return err
+	}
+	var oldEsc Asset
+	if old != nil {
+		if err = json.Unmarshal(old, &oldEsc); err != nil {
+			return err
+		}
+	}
+	if old == nil || oldEsc.IsWorking != esc.IsWorking || oldEsc.isDecommissioned() != esc.isDecommissioned() {
+		logged := *esc
+		if old != nil && esc.isDecommissioned() && !oldEsc.isDecommissioned() {
+			logged.IsWorking = oldEsc.IsWorking // see StateChange
+		}
+		if err = recordStateChange(stub, &logged, action); err != nil {
+			return err
+		}
+	}
+	escAsByteArr, err := json.Marshal(esc)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(assetKey(esc.AssetID), escAsByteArr)
 }
 
-//creates a sequential ID for either a new Ticket or a new Escalator. structname should be "ticket" or "escalator" respectively
+//creates a sequential ID for either a new Ticket or a new Asset. structname should be "ticket" or "asset" respectively
 func createID(stub shim.ChaincodeStubInterface, structName string) (string, error) {
 
 	var idAsBytes []byte
 	switch structName {
 	case "ticket":
-		idAsBytes, _ = stub.GetState("ticketCounter")
-	case "escalator":
-		idAsBytes, _ = stub.GetState("escalatorCounter")
+		idAsBytes, _ = stub.GetState(counterKey("ticket"))
+	case "asset":
+		idAsBytes, _ = stub.GetState(counterKey("asset"))
 	default:
-		return "", errors.New("ID creation not supported for input string: Must be ticketCounter or escalatorCounter")
+		return "", errors.New("ID creation not supported for input string: Must be ticket or asset")
 	}
 
 	// get highest current ticket id number from worldstate, increment and set as
@@ -950,6 +1823,6 @@ func createID(stub shim.ChaincodeStubInterface, structName string) (string, erro
 	idAsString := strconv.Itoa(idAsInt)
 	idAsString = leftPad2Len(idAsString, "0", 4)
 
-	stub.PutState(structName+"Counter", []byte(idAsString))
+	stub.PutState(counterKey(structName), []byte(idAsString))
 	return idAsString, nil
 }
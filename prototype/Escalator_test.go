@@ -0,0 +1,439 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// escalatorLocations holds the location of the escalators created by Init.
+var escalatorLocations = map[string][2]string{
+	"DO0001": {"Dortmund Hbf", "Gleis 4"},
+	"BR0002": {"Bremen Hbf", "Gleis 1"},
+}
+
+// reportFailure creates a ticket for one of the escalators created by Init.
+func (ledger *testLedger) reportFailure(device string) {
+	location := escalatorLocations[device]
+	ledger.mustInvoke("createTicket", location[0], location[1], device, "Motor", "#2356-102", "Totalausfall")
+}
+
+func (ledger *testLedger) sla(serviceProvider string) ServiceLevelAgreement {
+	result, err := ledger.query("getSLA", serviceProvider)
+	if err != nil {
+		ledger.t.Fatal(err)
+	}
+	var sla ServiceLevelAgreement
+	ledger.unmarshal(result, &sla)
+	return sla
+}
+
+func TestRepeatFailure(t *testing.T) {
+	tests := []struct {
+		name   string
+		device string
+		after  int64 // seconds between closing the first and creating the second ticket
+		repeat bool
+	}{
+		{"same escalator within window", "DO0001", 3600, true},
+		{"same escalator at window end", "DO0001", defaultWarrantyWindow, true},
+		{"same escalator after window", "DO0001", defaultWarrantyWindow + 1, false},
+		{"other escalator", "BR0002", 3600, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ledger := newTestLedger(t, 1000)
+			ledger.reportFailure("DO0001")
+			ledger.advanceTicket("0001", stateDone)
+			before := ledger.sla("Thyssen")
+
+			ledger.stub.time += test.after
+			ledger.reportFailure(test.device)
+			ticket := ledger.ticket("0002")
+			if ticket.RepeatFailure != test.repeat || (ticket.PreviousTicketID == "0001") != test.repeat {
+				t.Fatalf("RepeatFailure = %v, PreviousTicketID = %q", ticket.RepeatFailure, ticket.PreviousTicketID)
+			}
+
+			// closing the second ticket counts the repeat failure against the first repair
+			ledger.advanceTicket("0002", stateDone)
+			sla := ledger.sla("Thyssen")
+			var repeats, downgraded int64
+			if test.repeat {
+				repeats, downgraded = 1, 1
+			}
+			if sla.RepeatFailures != before.RepeatFailures+repeats || sla.None != before.None+1-downgraded ||
+				sla.Light != before.Light+downgraded {
+				t.Errorf("SLA before %+v, after %+v", before, sla)
+			}
+			if test.repeat && ledger.ticket("0001").SLAResult != slaLight {
+				t.Errorf("SLAResult of the first ticket = %s, want %s", ledger.ticket("0001").SLAResult, slaLight)
+			}
+		})
+	}
+}
+
+func TestSetWarrantyWindow(t *testing.T) {
+	tests := []struct {
+		window string
+		valid  bool
+	}{
+		{"0", true},
+		{"86400", true},
+		{"-1", false},
+		{"eine Woche", false},
+	}
+	for _, test := range tests {
+		ledger := newTestLedger(t, 1000)
+		err := ledger.invoke("setWarrantyWindow", test.window)
+		if (err == nil) != test.valid {
+			t.Errorf("setWarrantyWindow(%s): err = %v", test.window, err)
+		}
+		want := strconv.Itoa(defaultWarrantyWindow)
+		if test.valid {
+			want = test.window
+		}
+		if result, _ := ledger.query("getWarrantyWindow"); string(result) != want {
+			t.Errorf("getWarrantyWindow after setWarrantyWindow(%s) = %s, want %s", test.window, result, want)
+		}
+	}
+}
+
+func (ledger *testLedger) escalatorWorking(escalatorID string) bool {
+	result, err := ledger.query("getEscalatorState", escalatorID)
+	if err != nil {
+		ledger.t.Fatal(err)
+	}
+	return string(result) == "true"
+}
+
+func TestCancelTicket(t *testing.T) {
+	tests := []struct {
+		name    string
+		state   TicketState
+		args    []string // arguments after the TicketID
+		valid   bool
+		working bool // escalator state after the cancellation
+	}{
+		{"new ticket", stateNew, []string{"false_alarm"}, true, true},
+		{"with comment", stateOnSite, []string{"DUPLICATE", "siehe 0002"}, true, true},
+		{"unknown reason", stateNew, []string{"KEINE_LUST"}, false, false},
+		{"closed ticket", stateDone, []string{"OPERATOR_ERROR"}, false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ledger := newTestLedger(t, 1000)
+			ledger.mustInvoke("setEscalatorState", "DO0001", "false", "Motor", "#2356-102", "Totalausfall")
+			ledger.advanceTicket("0001", test.state)
+
+			err := ledger.invoke("cancelTicket", append([]string{"0001"}, test.args...)...)
+			if (err == nil) != test.valid {
+				t.Fatalf("cancelTicket: err = %v", err)
+			}
+			ticket := ledger.ticket("0001")
+			if test.valid && (ticket.currentState() != stateCancelled || ticket.CancelReason != strings.ToUpper(test.args[0])) {
+				t.Errorf("ticket after cancelTicket: %s, reason %s", ticket.currentState(), ticket.CancelReason)
+			}
+			if working := ledger.escalatorWorking("DO0001"); working != test.working {
+				t.Errorf("escalator working = %v, want %v", working, test.working)
+			}
+		})
+	}
+}
+
+func TestCancelTicketKeepsEscalatorBroken(t *testing.T) {
+	ledger := newTestLedger(t, 1000)
+	ledger.mustInvoke("setEscalatorState", "DO0001", "false", "Motor", "#2356-102", "Totalausfall")
+	ledger.reportFailure("DO0001")
+
+	ledger.mustInvoke("cancelTicket", "0001", "DUPLICATE")
+	if ledger.escalatorWorking("DO0001") {
+		t.Error("escalator is working while ticket 0002 is open")
+	}
+	ledger.mustInvoke("cancelTicket", "0002", "FALSE_ALARM")
+	if !ledger.escalatorWorking("DO0001") {
+		t.Error("escalator is still broken after cancelling all tickets")
+	}
+}
+
+func TestReassignTicketSLA(t *testing.T) {
+	type handover struct {
+		to, reason string
+		after      int64 // seconds after the ticket creation
+	}
+	tests := []struct {
+		name      string
+		handovers []handover
+		arrival   int64 // seconds after the ticket creation
+		provider  string
+		result    string
+	}{
+		{"no handover", nil, 3600, "Thyssen", slaNone},
+		{"provider fault", []handover{{"Otis", "PROVIDER_FAULT", 10800}}, 14400, "Thyssen", slaLight},
+		{"dispatch error", []handover{{"Otis", "DISPATCH_ERROR", 10800}}, 14400, "Otis", slaNone},
+		{"dispatch error, then unavailable", []handover{{"Otis", "dispatch_error", 3600},
+			{"Schindler", "PROVIDER_UNAVAILABLE", 10800}}, 14400, "Otis", slaLight},
+		{"fault, then dispatch error", []handover{{"Otis", "PROVIDER_FAULT", 3600},
+			{"Schindler", "DISPATCH_ERROR", 10800}}, 20000, "Thyssen", slaSevere},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ledger := newTestLedger(t, 1000)
+			ledger.reportFailure("DO0001")
+			ledger.mustInvoke("assignTicket", "0001", "Thyssen")
+			for _, h := range test.handovers {
+				ledger.stub.time = 1000 + h.after
+				ledger.mustInvoke("reassignTicket", "0001", h.to, h.reason, "Kommentar")
+			}
+			before := ledger.sla(test.provider)
+			ledger.mustInvoke("assignMechanic", "0001", "Hans")
+			ledger.mustInvoke("startJourney", "0001")
+			ledger.stub.time = 1000 + test.arrival
+			ledger.advanceTicket("0001", stateDone)
+
+			ticket := ledger.ticket("0001")
+			if len(ticket.Handovers) != len(test.handovers) || ticket.SLAResult != test.result {
+				t.Errorf("%d handovers, SLAResult %s, want %d, %s", len(ticket.Handovers), ticket.SLAResult,
+					len(test.handovers), test.result)
+			}
+			after := ledger.sla(test.provider)
+			after.count(test.result, -1)
+			if after != before {
+				t.Errorf("SLA of %s: %+v, want %s counted in %+v", test.provider, ledger.sla(test.provider), test.result,
+					before)
+			}
+		})
+	}
+}
+
+func TestReassignTicketErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"same provider", []string{"0001", "thyssen", "PROVIDER_FAULT"}},
+		{"unknown reason", []string{"0001", "Otis", "KEINE_LUST"}},
+		{"unknown ticket", []string{"0099", "Otis", "PROVIDER_FAULT"}},
+	}
+	for _, test := range tests {
+		ledger := newTestLedger(t, 1000)
+		ledger.reportFailure("DO0001")
+		ledger.mustInvoke("assignTicket", "0001", "Thyssen")
+		if err := ledger.invoke("reassignTicket", test.args...); err == nil {
+			t.Errorf("%s: reassignTicket%q did not fail", test.name, test.args)
+		}
+	}
+
+	// a new ticket has no provider to hand over from
+	ledger := newTestLedger(t, 1000)
+	ledger.reportFailure("DO0001")
+	if err := ledger.invoke("reassignTicket", "0001", "Otis", "DISPATCH_ERROR"); err == nil {
+		t.Error("reassignTicket of a new ticket did not fail")
+	}
+}
+
+func TestRepeatedFaultReports(t *testing.T) {
+	ledger := newTestLedger(t, 1000)
+	ledger.defineErrorCodes(assetTypeEscalator, "#2356-103", "#2356-104")
+	reports := []struct {
+		escalatorID string
+		errorID     string
+		ticketID    string // ticket the report is attached to
+	}{
+		{"DO0001", "#2356-102", "0001"},
+		{"DO0001", "#2356-103", "0001"},
+		{"BR0002", "#2356-102", "0002"},
+		{"DO0001", "#2356-104", "0001"},
+	}
+	for _, report := range reports {
+		ledger.stub.time += 60
+		result, err := ledger.cc.Invoke(ledger.stub, "setEscalatorState",
+			[]string{report.escalatorID, "false", "Motor", report.errorID, "Totalausfall"})
+		ledger.stub.commit()
+		if err != nil || string(result) != report.ticketID {
+			t.Errorf("setEscalatorState(%s, %s) = %s, %v, want %s", report.escalatorID, report.errorID, result, err,
+				report.ticketID)
+		}
+	}
+	ticket := ledger.ticket("0001")
+	if ticket.ErrorID != "#2356-102" || len(ticket.Occurrences) != 2 || ticket.Occurrences[1].ErrorID != "#2356-104" {
+		t.Errorf("ticket 0001: ErrorID %s, occurrences %+v", ticket.ErrorID, ticket.Occurrences)
+	}
+
+	// once the ticket is closed, the next failure opens a new one
+	ledger.advanceTicket("0001", stateDone)
+	result, err := ledger.cc.Invoke(ledger.stub, "setEscalatorState", []string{"DO0001", "false", "Motor", "#2356-102",
+		"Totalausfall"})
+	if err != nil || string(result) != "0003" {
+		t.Errorf("setEscalatorState after closing 0001 = %s, %v, want 0003", result, err)
+	}
+}
+
+func TestOpenTicketsWithinTransaction(t *testing.T) {
+	ledger := newTestLedger(t, 1000)
+	ledger.defineErrorCodes(assetTypeEscalator, "#2356-103")
+	// two reports in one transaction: the second one sees the ticket of the first, although range queries do not
+	ledger.cc.Invoke(ledger.stub, "setEscalatorState", []string{"DO0001", "false", "Motor", "#2356-102", "Totalausfall"})
+	ledger.cc.Invoke(ledger.stub, "setEscalatorState", []string{"DO0001", "false", "Motor", "#2356-103", "Totalausfall"})
+	ledger.stub.commit()
+	if counter, _ := ledger.query("getTicketCounter"); string(counter) != "0001" {
+		t.Errorf("ticket counter = %s, want 0001", counter)
+	}
+	if occurrences := ledger.ticket("0001").Occurrences; len(occurrences) != 1 {
+		t.Errorf("occurrences = %+v, want one", occurrences)
+	}
+}
+
+func TestRestoreEscalatorState(t *testing.T) {
+	tests := []struct {
+		name    string
+		second  bool   // a second ticket for the escalator is open
+		close   string // action closing the first ticket
+		working bool
+	}{
+		{"accepted", false, "acceptRepair", true},
+		{"cancelled", false, "cancelTicket", true},
+		{"not accepted yet", false, "finishRepair", false},
+		{"accepted, other ticket open", true, "acceptRepair", false},
+		{"cancelled, other ticket open", true, "cancelTicket", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ledger := newTestLedger(t, 1000)
+			ledger.mustInvoke("setEscalatorState", "DO0001", "false", "Motor", "#2356-102", "Totalausfall")
+			if test.second {
+				ledger.reportFailure("DO0001")
+			}
+			switch test.close {
+			case "cancelTicket":
+				ledger.mustInvoke("cancelTicket", "0001", "FALSE_ALARM")
+			case "finishRepair":
+				ledger.advanceTicket("0001", stateAwaitingAccept)
+			default:
+				ledger.advanceTicket("0001", stateDone)
+			}
+			if working := ledger.escalatorWorking("DO0001"); working != test.working {
+				t.Errorf("escalator working = %v, want %v", working, test.working)
+			}
+		})
+	}
+}
+
+func TestWorkingOverride(t *testing.T) {
+	ledger := newTestLedger(t, 1000)
+	ledger.mustInvoke("setEscalatorState", "DO0001", "false", "Motor", "#2356-102", "Totalausfall")
+
+	tests := []struct {
+		args  []string
+		valid bool
+	}{
+		{[]string{"DO0001", "true"}, false},
+		{[]string{"DO0001", "true", ""}, false},
+		{[]string{"DO0001", "true", "Notbetrieb freigegeben"}, true},
+	}
+	for _, test := range tests {
+		if err := ledger.invoke("setEscalatorState", test.args...); (err == nil) != test.valid {
+			t.Errorf("setEscalatorState%q: err = %v", test.args, err)
+		}
+	}
+	if !ledger.escalatorWorking("DO0001") || ledger.ticket("0001").WorkingOverride != "Notbetrieb freigegeben" {
+		t.Errorf("override was not applied: %+v", ledger.ticket("0001"))
+	}
+	if !ledger.ticket("0001").isOpen() {
+		t.Error("the override closed the ticket")
+	}
+}
+
+func TestAcceptRepair(t *testing.T) {
+	// the mechanic arrives right away, the agreed time to repair is 28800s
+	tests := []struct {
+		name   string
+		steps  []pauseStep // the role is ignored, finishRepair also writes the final report first
+		result string
+	}{
+		{"accepted after the agreed time", []pauseStep{
+			{20000, "", "finishRepair", nil},
+			{40000, "", "acceptRepair", []string{"Läuft wieder"}},
+		}, slaNone},
+		{"rejected", []pauseStep{
+			{20000, "", "finishRepair", nil},
+			{25000, "", "rejectRepair", []string{"Stufe klemmt"}},
+			{35000, "", "finishRepair", nil},
+			{36000, "", "acceptRepair", nil},
+		}, slaLight},
+		{"rejected twice", []pauseStep{
+			{20000, "", "finishRepair", nil},
+			{21000, "", "rejectRepair", []string{"Stufe klemmt"}},
+			{30000, "", "finishRepair", nil},
+			{31000, "", "rejectRepair", []string{"Stufe klemmt immer noch"}},
+			{50000, "", "finishRepair", nil},
+			{50000, "", "acceptRepair", nil},
+		}, slaSevere},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ledger := newTestLedger(t, 1000)
+			ledger.mustInvoke("setEscalatorState", "DO0001", "false", "Motor", "#2356-102", "Totalausfall")
+			ledger.advanceTicket("0001", stateRepairing)
+			var rejections int
+			for _, step := range test.steps {
+				ledger.stub.time = 1000 + step.after
+				switch step.function {
+				case "finishRepair":
+					ledger.advanceTicket("0001", stateAwaitingAccept)
+					if ledger.escalatorWorking("DO0001") || ledger.ticket("0001").SLAResult != "" {
+						t.Fatal("finishRepair closed the ticket")
+					}
+				default:
+					ledger.mustInvoke(step.function, append([]string{"0001"}, step.args...)...)
+				}
+				if step.function == "rejectRepair" {
+					rejections++
+				}
+			}
+
+			ticket := ledger.ticket("0001")
+			if ticket.currentState() != stateDone || !ledger.escalatorWorking("DO0001") {
+				t.Fatalf("ticket in state %s, escalator working %v", ticket.currentState(), ledger.escalatorWorking("DO0001"))
+			}
+			if ticket.SLAResult != test.result {
+				t.Errorf("SLAResult = %s, want %s", ticket.SLAResult, test.result)
+			}
+			if len(ticket.Rejections) != rejections || ticket.AcceptedAt != ledger.stub.time {
+				t.Errorf("Rejections = %+v, AcceptedAt = %d", ticket.Rejections, ticket.AcceptedAt)
+			}
+			for i, rejection := range ticket.Rejections {
+				if rejection.FinalRepairTime == 0 || rejection.FinalRepairTime == ticket.FinalRepairTime || rejection.Reason == "" {
+					t.Errorf("rejection %d: %+v", i, rejection)
+				}
+			}
+		})
+	}
+}
+
+func TestAcceptRepairErrors(t *testing.T) {
+	ledger := newTestLedger(t, 1000)
+	ledger.reportFailure("DO0001")
+	ledger.advanceTicket("0001", stateReporting)
+
+	tests := []struct {
+		function string
+		args     []string
+		valid    bool
+	}{
+		{"acceptRepair", []string{"0001"}, false},
+		{"rejectRepair", []string{"0001", "Stufe klemmt"}, false},
+		{"finishRepair", []string{"0001"}, true},
+		{"rejectRepair", []string{"0001"}, false},
+		{"rejectRepair", []string{"0001", ""}, false},
+		{"cancelTicket", []string{"0001", "FALSE_ALARM"}, false},
+		{"acceptRepair", []string{"0001", "ok", "ok"}, false},
+		{"acceptRepair", []string{"0002"}, false},
+		{"acceptRepair", []string{"0001"}, true},
+		{"rejectRepair", []string{"0001", "Stufe klemmt"}, false},
+	}
+	for _, test := range tests {
+		if err := ledger.invoke(test.function, test.args...); (err == nil) != test.valid {
+			t.Errorf("%s%q: err = %v", test.function, test.args, err)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Estimated repair time and predicted SLA breaches
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// An EtaRevision records a change of the predicted completion of a ticket, see reviseEta.
+type EtaRevision struct {
+	Previous      int64 // predicted completion before the revision
+	EstCompletion int64 // predicted completion after the revision
+	EstRepairTime string
+	Reason        string
+	RevisedBy     string
+	Time          int64
+}
+
+// A PredictedBreach is an open ticket whose predicted completion already lies past the TimeToRepair of its SLA.
+type PredictedBreach struct {
+	TicketID        string
+	ServiceProvider string // provider whose SLA is breached, see Ticket.scoredProvider
+	Status          string
+	RepairStatus    string
+	EstCompletion   int64
+	Deadline        int64 // time the repair has to be finished by, including the approved pauses so far
+	Level           string
+	OverdueBy       int64
+}
+
+// parseRepairDuration parses an estimated repair time, either as duration like "2h" or "1h30m" or as a number of
+// seconds, and returns it in seconds.
+func parseRepairDuration(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	seconds, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		duration, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, errors.New("EstRepairTime " + s + " is no duration, use e.g. 2h, 90m or a number of seconds")
+		}
+		seconds = int64(duration / time.Second)
+	}
+	if seconds <= 0 {
+		return 0, errors.New("EstRepairTime must be positive")
+	}
+	return seconds, nil
+}
+
+// Revise the predicted completion of a ticket the mechanic is working on. Arguments are the TicketID, the remaining
+// repair time from now (see parseRepairDuration) and the reason for the revision.
+func (t *SimpleChaincode) reviseEta(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 3 {
+		return nil, errors.New("Wrong number of arguments, must be 3: TicketID, EstRepairTime and reason")
+	}
+	remaining, err := parseRepairDuration(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if len(strings.TrimSpace(args[2])) == 0 {
+		return nil, errors.New("A reason is required to revise the estimated repair time")
+	}
+
+	ticket, err := getTicket(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if err = ticket.transition("reviseEta"); err != nil {
+		return nil, err
+	}
+	now := getTransactionTime(stub)
+	ticket.EtaRevisions = append(ticket.EtaRevisions, EtaRevision{
+		Previous:      ticket.EstCompletion,
+		EstCompletion: now + remaining,
+		EstRepairTime: args[1],
+		Reason:        args[2],
+		RevisedBy:     getCaller(stub),
+		Time:          now,
+	})
+	ticket.EstRepairTime = args[1]
+	ticket.EstCompletion = now + remaining
+
+	return nil, putTicket(stub, ticket, "reviseEta")
+}
+
+// returns all open tickets whose predicted completion is past the TimeToRepair of their SLA. Input is optionally a
+// ServiceProvider to restrict the result to the tickets scored against its SLA.
+func (t *SimpleChaincode) getPredictedBreaches(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) > 1 {
+		return nil, errors.New("Wrong number of arguments, must be 0 or 1: optionally a ServiceProvider")
+	}
+	serviceProvider := ""
+	if len(args) == 1 {
+		serviceProvider = args[0]
+	}
+
+	tickets, err := getTickets(stub)
+	if err != nil {
+		return nil, err
+	}
+	now := getTransactionTime(stub)
+	slas := map[string]*ServiceLevelAgreement{}
+
+	breaches := []PredictedBreach{}
+	for i := range tickets {
+		ticket := &tickets[i]
+		provider := ticket.scoredProvider()
+		// tickets without estimate, or already finished by the provider, have nothing left to predict
+		if !ticket.isOpen() || provider == "" || ticket.isPlanned() || ticket.EstCompletion == 0 || ticket.FinalRepairTime != 0 {
+			continue
+		}
+		if serviceProvider != "" && !strings.EqualFold(provider, serviceProvider) {
+			continue
+		}
+		sla, ok := slas[strings.ToLower(provider)]
+		if !ok {
+			sla, _ = getServiceLevelAgreement(stub, provider) // providers without SLA are skipped
+			slas[strings.ToLower(provider)] = sla
+		}
+		if sla == nil {
+			continue
+		}
+
+		start := ticket.slaStart()
+		deadline := start + ticket.pausedBetween(start, now) + sla.TimeToRepair
+		if ticket.EstCompletion <= deadline {
+			continue
+		}
+		breach := newSLABreach("TimeToRepair", ticket.EstCompletion-deadline, severeRepairDelay)
+		breaches = append(breaches, PredictedBreach{
+			TicketID:        ticket.TicketID,
+			ServiceProvider: provider,
+			Status:          ticket.Status,
+			RepairStatus:    ticket.RepairStatus,
+			EstCompletion:   ticket.EstCompletion,
+			Deadline:        deadline,
+			Level:           breach.Level,
+			OverdueBy:       breach.OverdueBy,
+		})
+	}
+	return json.Marshal(breaches)
+}
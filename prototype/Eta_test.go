@@ -0,0 +1,133 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseRepairDuration(t *testing.T) {
+	tests := []struct {
+		s     string
+		want  int64
+		valid bool
+	}{
+		{"2h", 7200, true},
+		{"1h30m", 5400, true},
+		{" 90m ", 5400, true},
+		{"3600", 3600, true},
+		{"0", 0, false},
+		{"-1h", 0, false},
+		{"2 Stunden", 0, false},
+		{"", 0, false},
+	}
+	for _, test := range tests {
+		seconds, err := parseRepairDuration(test.s)
+		if (err == nil) != test.valid || seconds != test.want {
+			t.Errorf("parseRepairDuration(%q) = %d, %v", test.s, seconds, err)
+		}
+	}
+}
+
+func (ledger *testLedger) predictedBreaches(args ...string) []PredictedBreach {
+	result, err := ledger.query("getPredictedBreaches", args...)
+	if err != nil {
+		ledger.t.Fatal(err)
+	}
+	var breaches []PredictedBreach
+	ledger.unmarshal(result, &breaches)
+	return breaches
+}
+
+func TestReviseEta(t *testing.T) {
+	// the mechanic arrives right away estimating 2h, the repair has to be finished 28800s after the ticket creation
+	tests := []struct {
+		args      []string // arguments after the TicketID
+		valid     bool
+		completed int64  // EstCompletion afterwards
+		level     string // predicted breach afterwards, empty for none
+	}{
+		{[]string{"5h", "Stufe verklemmt"}, true, 19000, ""},
+		{[]string{"10h", "Motor muss getauscht werden"}, true, 37000, slaLight},
+		{[]string{"20h", "Motor nicht lieferbar"}, true, 73000, slaSevere},
+		{[]string{"bald", "Motor nicht lieferbar"}, false, 73000, slaSevere},
+		{[]string{"1h", ""}, false, 73000, slaSevere},
+		{[]string{"1h"}, false, 73000, slaSevere},
+		{[]string{"1h", "Motor doch auf Lager"}, true, 4600, ""},
+	}
+	ledger := newTestLedger(t, 1000)
+	ledger.reportFailure("DO0001")
+	ledger.advanceTicket("0001", stateOnSite)
+	if completion := ledger.ticket("0001").EstCompletion; completion != 8200 {
+		t.Fatalf("EstCompletion after onArrival = %d, want 8200", completion)
+	}
+	for _, test := range tests {
+		if err := ledger.invoke("reviseEta", append([]string{"0001"}, test.args...)...); (err == nil) != test.valid {
+			t.Errorf("reviseEta%q: err = %v", test.args, err)
+		}
+		if completion := ledger.ticket("0001").EstCompletion; completion != test.completed {
+			t.Errorf("after reviseEta%q: EstCompletion = %d, want %d", test.args, completion, test.completed)
+		}
+		breaches := ledger.predictedBreaches()
+		if test.level == "" && len(breaches) != 0 || test.level != "" && (len(breaches) != 1 ||
+			breaches[0].Level != test.level || breaches[0].Deadline != 29800 || breaches[0].ServiceProvider != "Thyssen") {
+			t.Errorf("after reviseEta%q: predicted breaches %+v, want level %q", test.args, breaches, test.level)
+		}
+	}
+	if revisions := ledger.ticket("0001").EtaRevisions; len(revisions) != 4 || revisions[3].Previous != 73000 {
+		t.Errorf("EtaRevisions = %+v", revisions)
+	}
+}
+
+func TestPredictedBreaches(t *testing.T) {
+	ledger := newTestLedger(t, 1000)
+	ledger.reportFailure("DO0001")
+	ledger.advanceTicket("0001", stateOnSite)
+	ledger.mustInvoke("reviseEta", "0001", "10h", "Motor muss getauscht werden")
+	ledger.reportFailure("BR0002")
+	ledger.mustInvoke("assignTicket", "0002", "Otis")
+	ledger.advanceTicket("0002", stateOnSite)
+	ledger.mustInvoke("reviseEta", "0002", "30h", "Handlauf nicht lieferbar")
+
+	tests := []struct {
+		provider string
+		want     []string // TicketIDs
+	}{
+		{"", []string{"0001", "0002"}},
+		{"otis", []string{"0002"}},
+		{"Schindler", nil},
+	}
+	for _, test := range tests {
+		var breaches []PredictedBreach
+		if test.provider == "" {
+			breaches = ledger.predictedBreaches()
+		} else {
+			breaches = ledger.predictedBreaches(test.provider)
+		}
+		if len(breaches) != len(test.want) {
+			t.Errorf("getPredictedBreaches(%q) = %+v, want %v", test.provider, breaches, test.want)
+			continue
+		}
+		for i, breach := range breaches {
+			if breach.TicketID != test.want[i] {
+				t.Errorf("getPredictedBreaches(%q) = %+v, want %v", test.provider, breaches, test.want)
+			}
+		}
+	}
+
+	// the ETA of the previous provider moves to the handover, the ticket has no prediction anymore
+	ledger.mustInvoke("reassignTicket", "0002", "Thyssen", "PROVIDER_UNAVAILABLE")
+	ticket := ledger.ticket("0002")
+	handover := ticket.Handovers[0]
+	if ticket.EstCompletion != 0 || len(ticket.EtaRevisions) != 0 || handover.EstCompletion != 109000 ||
+		len(handover.EtaRevisions) != 1 {
+		t.Errorf("after reassignTicket: ticket %d %+v, handover %+v", ticket.EstCompletion, ticket.EtaRevisions, handover)
+	}
+	if breaches := ledger.predictedBreaches("Otis"); len(breaches) != 0 {
+		t.Errorf("predicted breaches of Otis after the handover: %+v", breaches)
+	}
+
+	// finishing the repair ends the prediction
+	ledger.advanceTicket("0001", stateAwaitingAccept)
+	if breaches := ledger.predictedBreaches(); len(breaches) != 0 {
+		t.Errorf("predicted breaches after finishRepair: %+v", breaches)
+	}
+}
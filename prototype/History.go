@@ -0,0 +1,209 @@
+// Ticket history
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// A TicketEvent records one change of a ticket. Events are append-only, they are written once under their own key
+// and never updated afterwards.
+type TicketEvent struct {
+	TicketID  string
+	Seq       int64  // position of the event in the ticket's history, starting at 1
+	Action    string // the invoke function that changed the ticket
+	Caller    string
+	Timestamp int64 // transaction time
+	TxID      string
+	Changes   []FieldChange
+}
+
+// FieldChange holds the JSON encoded value of a Ticket field before and after an event.
+type FieldChange struct {
+	Field string
+	Old   json.RawMessage `json:",omitempty"`
+	New   json.RawMessage `json:",omitempty"`
+}
+
+// returns the ordered list of events recorded for a ticket. Input is the TicketID.
+func (t *SimpleChaincode) getTicketHistory(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Wrong number of arguments, must be 1: TicketID")
+	}
+
+	ticket, err := getTicket(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	count, err := getHistoryCounter(stub, ticket.TicketID)
+	if err != nil {
+		return nil, err
+	}
+
+	// buffer is a JSON array containing the events
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+	for seq := int64(1); seq <= count; seq++ {
+		eventAsByteArr, err := stub.GetState(historyKey(ticket.TicketID, seq))
+		if err != nil {
+			return nil, err
+		}
+		if eventAsByteArr == nil {
+			return nil, errors.New("Event " + strconv.FormatInt(seq, 10) + " of ticket " + ticket.TicketID + " is missing")
+		}
+		if seq > 1 {
+			buffer.WriteString(",")
+		}
+		buffer.Write(eventAsByteArr)
+	}
+	buffer.WriteString("]")
+	return buffer.Bytes(), nil
+}
+
+// recordTicketEvent appends an event for action to the ticket's history. oldState is the ticket as currently stored
+// on the ledger (nil for a new ticket), newState the ticket about to be written.
+func recordTicketEvent(stub shim.ChaincodeStubInterface, ticketID string, action string, oldState []byte, newState []byte) error {
+	changes, err := diffTicketStates(oldState, newState)
+	if err != nil {
+		return err
+	}
+	return appendTicketEvent(stub, ticketID, action, changes)
+}
+
+// appendTicketEvent writes an event with the given changes as next entry of the ticket's history.
+func appendTicketEvent(stub shim.ChaincodeStubInterface, ticketID string, action string, changes []FieldChange) error {
+	count, err := getHistoryCounter(stub, ticketID)
+	if err != nil {
+		return err
+	}
+	count++
+
+	event := TicketEvent{
+		TicketID:  ticketID,
+		Seq:       count,
+		Action:    action,
+		Caller:    getCaller(stub),
+		Timestamp: getTransactionTime(stub),
+		TxID:      stub.GetTxID(),
+		Changes:   changes,
+	}
+	eventAsByteArr, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if err = stub.PutState(historyKey(ticketID, count), eventAsByteArr); err != nil {
+		return err
+	}
+	return stub.PutState(historyCounterKey(ticketID), []byte(strconv.FormatInt(count, 10)))
+}
+
+// diffTicketStates compares two JSON encoded tickets field by field. Fields are returned in alphabetical order, so
+// every peer computes the same event.
+func diffTicketStates(oldState []byte, newState []byte) ([]FieldChange, error) {
+	oldFields := map[string]json.RawMessage{}
+	newFields := map[string]json.RawMessage{}
+	if oldState != nil {
+		if err := json.Unmarshal(oldState, &oldFields); err != nil {
+			return nil, err
+		}
+	}
+	if err := json.Unmarshal(newState, &newFields); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name := range newFields {
+		names = append(names, name)
+	}
+	for name := range oldFields {
+		if _, ok := newFields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	changes := []FieldChange{}
+	for _, name := range names {
+		oldValue, existed := oldFields[name]
+		newValue := newFields[name]
+		if bytes.Equal(oldValue, newValue) || (!existed && isZeroJSON(newValue)) {
+			continue
+		}
+		changes = append(changes, FieldChange{Field: name, Old: oldValue, New: newValue})
+	}
+	return changes, nil
+}
+
+func isZeroJSON(value json.RawMessage) bool {
+	switch string(value) {
+	case `""`, "0", "false", "null", "[]", "{}":
+		return true
+	}
+	return false
+}
+
+// getCaller identifies the submitter of the current transaction by the "username" attribute of its certificate,
+// falling back to a fingerprint of the certificate itself.
+func getCaller(stub shim.ChaincodeStubInterface) string {
+	username, err := stub.ReadCertAttribute("username")
+	if err == nil && len(username) > 0 {
+		return string(username)
+	}
+	cert, err := stub.GetCallerCertificate()
+	if err == nil && len(cert) > 0 {
+		fingerprint := sha256.Sum256(cert)
+		return "cert:" + hex.EncodeToString(fingerprint[:8])
+	}
+	return "unknown"
+}
+
+// roles of the callers, taken from the "role" attribute of their certificate
+const (
+	roleOperator   = "OPERATOR"   // station operator
+	roleDispatcher = "DISPATCHER" // dispatcher of the service provider
+	roleMechanic   = "MECHANIC"   // mechanic of the service provider
+)
+
+// getCallerRole returns the "role" attribute of the caller's certificate, which has to be one of the roles above.
+func getCallerRole(stub shim.ChaincodeStubInterface) (string, error) {
+	roleAsByteArr, err := stub.ReadCertAttribute("role")
+	role := strings.ToUpper(string(roleAsByteArr))
+	if err != nil || (role != roleOperator && role != roleDispatcher && role != roleMechanic) {
+		return "", errors.New("The certificate of the caller has no role attribute OPERATOR, DISPATCHER or MECHANIC")
+	}
+	return role, nil
+}
+
+// getCallerProvider returns the "serviceProvider" attribute of the caller's certificate, or "" if there is none, e.g.
+// for the station operator.
+func getCallerProvider(stub shim.ChaincodeStubInterface) string {
+	provider, err := stub.ReadCertAttribute("serviceProvider")
+	if err != nil {
+		return ""
+	}
+	return string(provider)
+}
+
+func getHistoryCounter(stub shim.ChaincodeStubInterface, ticketID string) (int64, error) {
+	countAsByteArr, err := stub.GetState(historyCounterKey(ticketID))
+	if err != nil || countAsByteArr == nil {
+		return 0, err
+	}
+	return strconv.ParseInt(string(countAsByteArr), 10, 64)
+}
+
+func historyCounterKey(ticketID string) string {
+	return counterKey("history/" + ticketID)
+}
+
+func historyKey(ticketID string, seq int64) string {
+	return "history/" + ticketID + "/" + leftPad2Len(strconv.FormatInt(seq, 10), "0", 6)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTicketHistory(t *testing.T) {
+	ledger := newTestLedger(t, 1000)
+	ledger.stub.attributes["username"] = "leitstelle"
+	ledger.mustInvoke("createDefaultTicket")
+	ledger.advanceTicket("0001", stateDone)
+
+	result, err := ledger.query("getTicketHistory", "0001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []TicketEvent
+	ledger.unmarshal(result, &events)
+
+	wantActions := []string{"createDefaultTicket"}
+	for _, step := range ticketWorkflow {
+		if step.action != "" {
+			wantActions = append(wantActions, step.action)
+		}
+	}
+	if len(events) != len(wantActions) {
+		t.Fatalf("got %d events, want %d", len(events), len(wantActions))
+	}
+	for i, event := range events {
+		if event.Seq != int64(i+1) || event.Action != wantActions[i] || event.TicketID != "0001" ||
+			event.Caller != "leitstelle" || event.Timestamp != 1000 {
+			t.Errorf("event %d = %+v, want action %s", i+1, event, wantActions[i])
+		}
+	}
+
+	// assignTicket changes exactly the status, the repair status and the service provider
+	var fields []string
+	for _, change := range events[1].Changes {
+		fields = append(fields, change.Field)
+	}
+	if want := []string{"RepairStatus", "ServiceProvider", "Status"}; !reflect.DeepEqual(fields, want) {
+		t.Errorf("assignTicket changed %q, want %q", fields, want)
+	}
+}
+
+func TestTicketHistoryErrors(t *testing.T) {
+	ledger := newTestLedger(t, 1000)
+	ledger.mustInvoke("createDefaultTicket")
+	ledger.mustInvoke("assignTicket", "0001", "Otis")
+	ledger.stub.DelState(historyKey("0001", 1))
+	ledger.stub.commit()
+
+	tests := []struct {
+		name     string
+		ticketID string
+	}{
+		{"missing event", "0001"},
+		{"unknown ticket", "0099"},
+	}
+	for _, test := range tests {
+		if _, err := ledger.query("getTicketHistory", test.ticketID); err == nil {
+			t.Errorf("%s: getTicketHistory(%s) did not fail", test.name, test.ticketID)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+// Spare part inventory
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// A Part is an entry of the spare parts catalogue.
+type Part struct {
+	PartNumber  string
+	Description string
+	Unit        string // e.g. "Stueck" or "Meter"
+}
+
+// Stock is the quantity of a part held in one depot of a service provider.
+type Stock struct {
+	ServiceProvider string
+	Depot           string
+	PartNumber      string
+	Quantity        int64
+}
+
+// A StockMovement records every change of a Stock. Movements are numbered sequentially and never changed afterwards.
+type StockMovement struct {
+	Seq             int64
+	Kind            string // "RECEIVE", "ADJUST" or "CONSUME"
+	ServiceProvider string
+	Depot           string
+	PartNumber      string
+	Delta           int64
+	Reason          string
+	TicketID        string // only for CONSUME
+	Device          string // only for CONSUME
+	Time            int64
+}
+
+const (
+	movementReceive = "RECEIVE"
+	movementAdjust  = "ADJUST"
+	movementConsume = "CONSUME"
+)
+
+// PartsConsumption lists the parts consumed by repairs together with the total quantity per part number.
+type PartsConsumption struct {
+	Movements []StockMovement
+	Totals    map[string]int64
+}
+
+// Add a part to the catalogue. Arguments are the PartNumber, a description and optionally the unit (default "Stueck").
+// Parts already in the catalogue are not replaced.
+func (t *SimpleChaincode) createPart(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, errors.New("Wrong number of arguments, must be 2 or 3: PartNumber, Description and optionally Unit")
+	}
+	if args[0] == "" || strings.ContainsAny(args[0], "/~") {
+		return nil, errors.New("PartNumber must not be empty or contain / or ~")
+	}
+	existing, err := stub.GetState(partKey(args[0]))
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, errors.New("Part " + args[0] + " is already in the catalogue")
+	}
+	part := Part{PartNumber: args[0], Description: args[1], Unit: "Stueck"}
+	if len(args) == 3 {
+		part.Unit = args[2]
+	}
+	partAsByteArr, err := json.Marshal(part)
+	if err != nil {
+		return nil, err
+	}
+	return nil, stub.PutState(partKey(part.PartNumber), partAsByteArr)
+}
+
+// Book a delivery of parts into a depot. Arguments are ServiceProvider, Depot, PartNumber and the (positive) quantity.
+func (t *SimpleChaincode) receiveParts(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 4 {
+		return nil, errors.New("Wrong number of arguments, must be 4: ServiceProvider, Depot, PartNumber and Quantity")
+	}
+	quantity, err := strconv.ParseInt(args[3], 10, 64)
+	if err != nil || quantity <= 0 {
+		return nil, errors.New("Quantity must be a positive number")
+	}
+	return nil, moveStock(stub, StockMovement{
+		Kind:            movementReceive,
+		ServiceProvider: args[0],
+		Depot:           args[1],
+		PartNumber:      args[2],
+		Delta:           quantity,
+	})
+}
+
+// Correct the stock of a depot, e.g. after a stocktaking. Arguments are ServiceProvider, Depot, PartNumber, the change
+// of the quantity (may be negative) and a reason.
+func (t *SimpleChaincode) adjustStock(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 5 {
+		return nil, errors.New("Wrong number of arguments, must be 5: ServiceProvider, Depot, PartNumber, change of Quantity and reason")
+	}
+	delta, err := strconv.ParseInt(args[3], 10, 64)
+	if err != nil || delta == 0 {
+		return nil, errors.New("Change of Quantity must be a number other than 0")
+	}
+	if args[4] == "" {
+		return nil, errors.New("A reason is needed to adjust the stock")
+	}
+	return nil, moveStock(stub, StockMovement{
+		Kind:            movementAdjust,
+		ServiceProvider: args[0],
+		Depot:           args[1],
+		PartNumber:      args[2],
+		Delta:           delta,
+		Reason:          args[4],
+	})
+}
+
+// returns the parts catalogue
+func (t *SimpleChaincode) getParts(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	return getRangeAsJSONArray(stub, partKey(""), partKey("~"))
+}
+
+// returns the stock levels of a ServiceProvider. Optionally takes a Depot as second argument.
+func (t *SimpleChaincode) getStock(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, errors.New("Wrong number of arguments, must be 1 or 2: ServiceProvider and optionally Depot")
+	}
+	depot := ""
+	if len(args) == 2 {
+		depot = args[1]
+	}
+	return getRangeAsJSONArray(stub, stockPrefix(args[0], depot), stockPrefix(args[0], depot)+"~")
+}
+
+// returns the parts consumed by the repairs of an asset. Input is the AssetID.
+func (t *SimpleChaincode) getPartsConsumptionByAsset(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Wrong number of arguments, must be 1: AssetID")
+	}
+	return getPartsConsumption(stub, func(movement *StockMovement) bool {
+		return movement.Device == args[0]
+	})
+}
+
+// returns the parts consumed by the repairs of a service provider. Input is the ServiceProvider.
+func (t *SimpleChaincode) getPartsConsumptionByProvider(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Wrong number of arguments, must be 1: ServiceProvider")
+	}
+	return getPartsConsumption(stub, func(movement *StockMovement) bool {
+		return strings.EqualFold(movement.ServiceProvider, args[0])
+	})
+}
+
+func getPartsConsumption(stub shim.ChaincodeStubInterface, include func(*StockMovement) bool) ([]byte, error) {
+	movements, err := getStockMovements(stub)
+	if err != nil {
+		return nil, err
+	}
+	consumption := PartsConsumption{Movements: []StockMovement{}, Totals: map[string]int64{}}
+	for i := range movements {
+		if movements[i].Kind != movementConsume || !include(&movements[i]) {
+			continue
+		}
+		consumption.Movements = append(consumption.Movements, movements[i])
+		consumption.Totals[movements[i].PartNumber] -= movements[i].Delta
+	}
+	return json.Marshal(consumption)
+}
+
+// consumeReplacedParts books the parts of a final report out of the depots of the ticket's service provider. If the
+// ticket already has a report, only the difference to it is booked, so a corrected report returns parts that are no
+// longer listed to their depot.
+func consumeReplacedParts(stub shim.ChaincodeStubInterface, ticket *Ticket, report *RepairReport) error {
+	type consumed struct{ depot, partNumber string }
+	var order []consumed
+	deltas := map[consumed]int64{}
+	book := func(parts []ReplacedPart, sign int64) error {
+		for _, part := range parts {
+			if part.Depot == "" {
+				return errors.New("Replaced part " + part.PartNumber + " needs the Depot it was taken from")
+			}
+			key := consumed{part.Depot, part.PartNumber}
+			if _, ok := deltas[key]; !ok {
+				order = append(order, key)
+			}
+			deltas[key] += sign * part.Quantity
+		}
+		return nil
+	}
+	if ticket.Report != nil {
+		if err := book(ticket.Report.PartsReplaced, 1); err != nil {
+			return err
+		}
+	}
+	if err := book(report.PartsReplaced, -1); err != nil {
+		return err
+	}
+
+	for _, key := range order {
+		if deltas[key] == 0 {
+			continue
+		}
+		err := moveStock(stub, StockMovement{
+			Kind:            movementConsume,
+			ServiceProvider: ticket.ServiceProvider,
+			Depot:           key.depot,
+			PartNumber:      key.partNumber,
+			Delta:           deltas[key],
+			TicketID:        ticket.TicketID,
+			Device:          ticket.Device,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveStock applies a movement to the stock it names and appends it to the movement log. The stock must not become
+// negative. The service provider and the depot are part of the stock key, so they must not contain the key separators.
+func moveStock(stub shim.ChaincodeStubInterface, movement StockMovement) error {
+	if movement.ServiceProvider == "" || strings.ContainsAny(movement.ServiceProvider, "/~") {
+		return errors.New("ServiceProvider must not be empty or contain / or ~")
+	}
+	if movement.Depot == "" || strings.ContainsAny(movement.Depot, "/~") {
+		return errors.New("Depot must not be empty or contain / or ~")
+	}
+	if _, err := getPart(stub, movement.PartNumber); err != nil {
+		return err
+	}
+	stock, err := getStock(stub, movement.ServiceProvider, movement.Depot, movement.PartNumber)
+	if err != nil {
+		return err
+	}
+	stock.Quantity += movement.Delta
+	if stock.Quantity < 0 {
+		return errors.New("Not enough " + movement.PartNumber + " in stock at depot " + movement.Depot + " of " + movement.ServiceProvider)
+	}
+	stockAsByteArr, err := json.Marshal(stock)
+	if err != nil {
+		return err
+	}
+	if err = stub.PutState(stockKey(movement.ServiceProvider, movement.Depot, movement.PartNumber), stockAsByteArr); err != nil {
+		return err
+	}
+
+	seq, err := nextSequence(stub, counterKey("stockMovement"))
+	if err != nil {
+		return err
+	}
+	movement.Seq = seq
+	movement.Time = getTransactionTime(stub)
+	movementAsByteArr, err := json.Marshal(movement)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(stockMovementKey(seq), movementAsByteArr)
+}
+
+func getPart(stub shim.ChaincodeStubInterface, partNumber string) (*Part, error) {
+	partAsByteArr, err := stub.GetState(partKey(partNumber))
+	if err != nil {
+		return nil, err
+	}
+	if partAsByteArr == nil {
+		return nil, errors.New("Unknown part " + partNumber + ", see getParts")
+	}
+	part := new(Part)
+	if err = json.Unmarshal(partAsByteArr, part); err != nil {
+		return nil, err
+	}
+	return part, nil
+}
+
+// getStock returns the stock of a part in a depot, which is empty if the part was never received there.
+func getStock(stub shim.ChaincodeStubInterface, serviceProvider string, depot string, partNumber string) (*Stock, error) {
+	stock := &Stock{ServiceProvider: serviceProvider, Depot: depot, PartNumber: partNumber}
+	stockAsByteArr, err := stub.GetState(stockKey(serviceProvider, depot, partNumber))
+	if err != nil || stockAsByteArr == nil {
+		return stock, err
+	}
+	if err = json.Unmarshal(stockAsByteArr, stock); err != nil {
+		return nil, err
+	}
+	return stock, nil
+}
+
+func getStockMovements(stub shim.ChaincodeStubInterface) ([]StockMovement, error) {
+	var movements []StockMovement
+	err := forEachInRange(stub, stockMovementPrefix, stockMovementPrefix+"~", func(value []byte) error {
+		var movement StockMovement
+		if err := json.Unmarshal(value, &movement); err != nil {
+			return err
+		}
+		movements = append(movements, movement)
+		return nil
+	})
+	return movements, err
+}
+
+func partKey(partNumber string) string {
+	return "part/" + partNumber
+}
+
+func stockKey(serviceProvider string, depot string, partNumber string) string {
+	return stockPrefix(serviceProvider, depot) + partNumber
+}
+
+// stockPrefix is the common prefix of the stock keys of a service provider, or of one of its depots if depot is not
+// empty.
+func stockPrefix(serviceProvider string, depot string) string {
+	prefix := "stock/" + strings.ToLower(serviceProvider) + "/"
+	if depot != "" {
+		prefix += depot + "/"
+	}
+	return prefix
+}
+
+// stock movements are stored under stockMovementPrefix and their zero padded Seq, in the order they were booked
+const stockMovementPrefix = "stockMovement/"
+
+func stockMovementKey(seq int64) string {
+	return stockMovementPrefix + leftPad2Len(strconv.FormatInt(seq, 10), "0", 12)
+}
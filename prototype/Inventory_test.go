@@ -0,0 +1,141 @@
+package main
+
+import (
+	"testing"
+)
+
+func (ledger *testLedger) stockQuantity(serviceProvider string, depot string, partNumber string) int64 {
+	stock, err := getStock(ledger.stub, serviceProvider, depot, partNumber)
+	if err != nil {
+		ledger.t.Fatal(err)
+	}
+	return stock.Quantity
+}
+
+func TestStockMovements(t *testing.T) {
+	ledger := newTestLedger(t, 1000)
+	ledger.mustInvoke("createPart", "HL-200", "Handlauf", "Meter")
+
+	tests := []struct {
+		function string
+		args     []string
+		valid    bool
+		quantity int64 // HL-200 at Thyssen/Dortmund afterwards
+	}{
+		{"receiveParts", []string{"Thyssen", "Dortmund", "HL-200", "10"}, true, 10},
+		{"receiveParts", []string{"Thyssen", "Dortmund", "HL-200", "0"}, false, 10},
+		{"receiveParts", []string{"Thyssen", "Dortmund", "HL-300", "1"}, false, 10},
+		{"receiveParts", []string{"Thyssen", "Dort/mund", "HL-200", "1"}, false, 10},
+		{"receiveParts", []string{"Thys~sen", "Dortmund", "HL-200", "1"}, false, 10},
+		{"receiveParts", []string{"", "Dortmund", "HL-200", "1"}, false, 10},
+		{"adjustStock", []string{"Thyssen", "Dortmund", "HL-200", "-3", "Inventur"}, true, 7},
+		{"adjustStock", []string{"Thyssen", "Dortmund", "HL-200", "-8", "Inventur"}, false, 7},
+		{"adjustStock", []string{"Thyssen", "Dortmund", "HL-200", "2", ""}, false, 7},
+		{"createPart", []string{"HL-200", "Handlauf"}, false, 7},
+		{"createPart", []string{"HL/200", "Handlauf"}, false, 7},
+	}
+	for _, test := range tests {
+		if err := ledger.invoke(test.function, test.args...); (err == nil) != test.valid {
+			t.Errorf("%s%q: err = %v", test.function, test.args, err)
+		}
+		if quantity := ledger.stockQuantity("Thyssen", "Dortmund", "HL-200"); quantity != test.quantity {
+			t.Errorf("after %s%q: quantity = %d, want %d", test.function, test.args, quantity, test.quantity)
+		}
+	}
+}
+
+func TestConsumeReplacedParts(t *testing.T) {
+	report := func(parts string) string {
+		return `{"RootCause":"WEAR","PartsReplaced":[` + parts + `],"Labour":[{"Mechanic":"Hans","Hours":1}]}`
+	}
+	tests := []struct {
+		name     string
+		reports  []string // reports written one after the other
+		valid    bool     // whether the last report is accepted
+		dortmund int64    // RTM-X 64 at Thyssen/Dortmund afterwards, 3 were received
+		bremen   int64    // RTM-X 64 at Thyssen/Bremen afterwards, 1 was received
+	}{
+		{"no parts", []string{report("")}, true, 3, 1},
+		{"in stock", []string{report(`{"PartNumber":"RTM-X 64","Quantity":2,"Depot":"Dortmund"}`)}, true, 1, 1},
+		{"two depots", []string{report(`{"PartNumber":"RTM-X 64","Quantity":3,"Depot":"Dortmund"},
+			{"PartNumber":"RTM-X 64","Quantity":1,"Depot":"Bremen"}`)}, true, 0, 0},
+		{"not in stock", []string{report(`{"PartNumber":"RTM-X 64","Quantity":2,"Depot":"Bremen"}`)}, false, 3, 1},
+		{"unknown part", []string{report(`{"PartNumber":"XYZ","Quantity":1,"Depot":"Dortmund"}`)}, false, 3, 1},
+		{"no depot", []string{report(`{"PartNumber":"RTM-X 64","Quantity":1}`)}, false, 3, 1},
+		{"corrected to fewer", []string{report(`{"PartNumber":"RTM-X 64","Quantity":3,"Depot":"Dortmund"}`),
+			report(`{"PartNumber":"RTM-X 64","Quantity":1,"Depot":"Dortmund"}`)}, true, 2, 1},
+		{"corrected to other depot", []string{report(`{"PartNumber":"RTM-X 64","Quantity":1,"Depot":"Dortmund"}`),
+			report(`{"PartNumber":"RTM-X 64","Quantity":1,"Depot":"Bremen"}`)}, true, 3, 0},
+		{"correction not in stock", []string{report(`{"PartNumber":"RTM-X 64","Quantity":3,"Depot":"Dortmund"}`),
+			report(`{"PartNumber":"RTM-X 64","Quantity":4,"Depot":"Dortmund"}`)}, false, 0, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ledger := newTestLedger(t, 1000)
+			ledger.mustInvoke("receiveParts", "Thyssen", "Dortmund", "RTM-X 64", "3")
+			ledger.mustInvoke("receiveParts", "Thyssen", "Bremen", "RTM-X 64", "1")
+			ledger.reportFailure("DO0001")
+			ledger.advanceTicket("0001", stateRepairing)
+			for i, report := range test.reports {
+				err := ledger.invoke("writeFinalReport", "0001", report)
+				if last := i == len(test.reports)-1; err != nil && (!last || test.valid) {
+					t.Fatalf("writeFinalReport(%s): %v", report, err)
+				} else if last && err == nil && !test.valid {
+					t.Fatalf("writeFinalReport(%s) was accepted", report)
+				}
+			}
+			dortmund := ledger.stockQuantity("Thyssen", "Dortmund", "RTM-X 64")
+			bremen := ledger.stockQuantity("Thyssen", "Bremen", "RTM-X 64")
+			if dortmund != test.dortmund || bremen != test.bremen {
+				t.Errorf("stock Dortmund %d, Bremen %d, want %d, %d", dortmund, bremen, test.dortmund, test.bremen)
+			}
+
+			// finishing the repair books nothing more
+			if test.valid {
+				ledger.advanceTicket("0001", stateDone)
+				if quantity := ledger.stockQuantity("Thyssen", "Dortmund", "RTM-X 64"); quantity != test.dortmund {
+					t.Errorf("finishRepair changed the stock to %d", quantity)
+				}
+			}
+		})
+	}
+}
+
+func TestPartsConsumption(t *testing.T) {
+	ledger := newTestLedger(t, 1000)
+	ledger.mustInvoke("receiveParts", "Thyssen", "Dortmund", "RTM-X 64", "5")
+	ledger.mustInvoke("receiveParts", "Otis", "Dortmund", "RTM-X 64", "5")
+	ledger.reportFailure("DO0001")
+	ledger.advanceTicket("0001", stateRepairing)
+	ledger.mustInvoke("writeFinalReport", "0001", `{"RootCause":"WEAR",
+		"PartsReplaced":[{"PartNumber":"RTM-X 64","Quantity":2,"Depot":"Dortmund"}],"Labour":[{"Mechanic":"Hans","Hours":1}]}`)
+
+	// the ticket is handed over after the report, the new provider uses parts of its own
+	ledger.mustInvoke("reassignTicket", "0001", "Otis", "PROVIDER_FAULT")
+	ledger.advanceTicket("0001", stateRepairing)
+	ledger.mustInvoke("writeFinalReport", "0001", `{"RootCause":"WEAR",
+		"PartsReplaced":[{"PartNumber":"RTM-X 64","Quantity":1,"Depot":"Dortmund"}],"Labour":[{"Mechanic":"Eva","Hours":1}]}`)
+	ledger.advanceTicket("0001", stateDone)
+
+	tests := []struct {
+		function string
+		arg      string
+		want     int64
+	}{
+		{"getPartsConsumptionByEscalator", "DO0001", 3},
+		{"getPartsConsumptionByEscalator", "BR0002", 0},
+		{"getPartsConsumptionByProvider", "thyssen", 2},
+		{"getPartsConsumptionByProvider", "Otis", 1},
+	}
+	for _, test := range tests {
+		result, err := ledger.query(test.function, test.arg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var consumption PartsConsumption
+		ledger.unmarshal(result, &consumption)
+		if consumption.Totals["RTM-X 64"] != test.want {
+			t.Errorf("%s(%s) = %s, want %d", test.function, test.arg, result, test.want)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+// World state key scheme
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Every entity is stored under "<type>/<id>". Range scans over one type go from the prefix to prefix+"~".
+const (
+	ticketPrefix  = "ticket/"
+	assetPrefix   = "asset/"
+	slaPrefix     = "sla/"
+	counterPrefix = "counter/"
+	configPrefix  = "config/"
+)
+
+// keySchemaVersion is stored under configKey("keySchema") once the world state uses the namespaced keys.
+// Ledgers written by the first version of the chaincode with flat keys are converted with migrateKeys.
+const keySchemaVersion = "2"
+
+// legacyEscalator is an Asset as written before asset types existed, identified by its EscalatorID.
+type legacyEscalator struct {
+	Asset
+	EscalatorID string
+}
+
+// width of the numeric part of ticket keys, keeps them in TicketID order far beyond "9999"
+const ticketKeyWidth = 12
+
+// ticketKey pads the TicketID, so tickets are ordered by number no matter how many digits the ID has.
+func ticketKey(ticketID string) string {
+	return ticketPrefix + leftPad2Len(ticketID, "0", ticketKeyWidth)
+}
+
+func assetKey(assetID string) string {
+	return assetPrefix + assetID
+}
+
+func slaKey(serviceProvider string) string {
+	return slaPrefix + strings.ToLower(serviceProvider)
+}
+
+func counterKey(name string) string {
+	return counterPrefix + name
+}
+
+func configKey(name string) string {
+	return configPrefix + name
+}
+
+// Convert a world state written with the flat keys of the first version ("0001", "DO0001", "slaotis", "ticketCounter",
+// ...) to the namespaced keys. Escalators become assets of type ESCALATOR, their stations and platforms are registered
+// unless they already are, the lists of open tickets per device are built. Can only be run once, on a ledger that was
+// not yet converted.
+func (t *SimpleChaincode) migrateKeys(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	version, err := stub.GetState(configKey("keySchema"))
+	if err != nil {
+		return nil, err
+	}
+	if string(version) == keySchemaVersion {
+		return nil, errors.New("World state already uses key schema " + keySchemaVersion)
+	}
+
+	moves := map[string]string{}
+	converted := map[string][]byte{} // new values of moved keys whose records changed their format
+	if err = migrateFlatKeys(stub, moves, converted); err != nil {
+		return nil, err
+	}
+	for i := range builtinAssetTypes {
+		if _, err = getAssetType(stub, builtinAssetTypes[i].AssetType); err == nil {
+			continue
+		}
+		if err = putAssetType(stub, &builtinAssetTypes[i]); err != nil {
+			return nil, err
+		}
+		for _, code := range builtinErrorCodes {
+			if code.AssetType != builtinAssetTypes[i].AssetType {
+				continue
+			}
+			if err = addErrorCode(stub, &code); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// apply the moves in key order, so every peer writes the same
+	var oldKeys []string
+	for oldKey := range moves {
+		oldKeys = append(oldKeys, oldKey)
+	}
+	sort.Strings(oldKeys)
+	for _, oldKey := range oldKeys {
+		value, ok := converted[oldKey]
+		if !ok {
+			err = moveState(stub, oldKey, moves[oldKey])
+		} else if err = stub.PutState(moves[oldKey], value); err == nil {
+			err = stub.DelState(oldKey)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return []byte(strconv.Itoa(len(moves))), stub.PutState(configKey("keySchema"), []byte(keySchemaVersion))
+}
+
+// migrateFlatKeys collects the moves from the flat keys of the first version, which only stored the two counters,
+// tickets, escalators and SLAs.
+func migrateFlatKeys(stub shim.ChaincodeStubInterface, moves map[string]string, converted map[string][]byte) error {
+	moves["ticketCounter"] = counterKey("ticket")
+	moves["escalatorCounter"] = counterKey("asset")
+
+	// tickets were stored under their four digit TicketID, the only keys starting with a digit
+	err := forEachKeyInRange(stub, "0", "9~", func(key string, value []byte) error {
+		var ticket Ticket
+		if json.Unmarshal(value, &ticket) != nil || ticket.TicketID != key {
+			return nil
+		}
+		moves[key] = ticketKey(key)
+		if !ticket.isOpen() {
+			return nil
+		}
+		return updateOpenTickets(stub, &ticket, true)
+	})
+	if err != nil {
+		return err
+	}
+
+	// escalators were stored under their EscalatorID, the only keys starting with an upper case letter
+	locations := migratedLocations{stations: map[string]*Station{}, platforms: map[string]*Platform{}}
+	err = forEachKeyInRange(stub, "A", "Z~", func(key string, value []byte) error {
+		asset := convertEscalator(value)
+		if asset == nil || asset.AssetID != key {
+			return nil
+		}
+		if err := locations.register(stub, asset); err != nil {
+			return err
+		}
+		return convertTo(moves, converted, key, assetKey(key), asset)
+	})
+	if err != nil {
+		return err
+	}
+
+	// SLAs were stored under "sla" + lower case ServiceProvider
+	return forEachKeyInRange(stub, "sla", "sla~", func(key string, value []byte) error {
+		var sla ServiceLevelAgreement
+		if json.Unmarshal(value, &sla) == nil && key == "sla"+strings.ToLower(sla.ServiceProvider) {
+			moves[key] = slaKey(sla.ServiceProvider)
+		}
+		return nil
+	})
+}
+
+// convertEscalator reads an escalator record written before asset types existed, nil if value is none.
+func convertEscalator(value []byte) *Asset {
+	var esc legacyEscalator
+	if json.Unmarshal(value, &esc) != nil || esc.EscalatorID == "" {
+		return nil
+	}
+	esc.AssetID = esc.EscalatorID
+	esc.AssetType = assetTypeEscalator
+	if esc.CommissioningStatus == "" {
+		esc.CommissioningStatus = commissioningInService
+	}
+	return &esc.Asset
+}
+
+// migratedLocations registers the free text locations of migrated escalators as stations and platforms. It keeps what
+// it registered, as a range scan may not return what the current transaction wrote.
+type migratedLocations struct {
+	stations  map[string]*Station  // by lower case name
+	platforms map[string]*Platform // by StationID + "/" + lower case name
+}
+
+// register resolves the Trainstation and Platform of the asset against the registry, registers them if they are
+// missing and sets the StationID and PlatformID of the asset. New stations get the letters the AssetID starts with as
+// StationID, new platforms the last word of their name as PlatformID, e.g. "4" for "Gleis 4".
+func (locations *migratedLocations) register(stub shim.ChaincodeStubInterface, asset *Asset) error {
+	name := strings.TrimSpace(asset.Trainstation)
+	station := locations.stations[strings.ToLower(name)]
+	if station == nil {
+		var err error
+		if station, err = resolveStation(stub, name); err != nil {
+			if station, err = newMigratedStation(stub, asset.AssetID, name); err != nil {
+				return err
+			}
+			if err = putStation(stub, station); err != nil {
+				return err
+			}
+		}
+		locations.stations[strings.ToLower(name)] = station
+	}
+
+	name = strings.TrimSpace(asset.Platform)
+	platform := locations.platforms[station.StationID+"/"+strings.ToLower(name)]
+	if platform == nil {
+		var err error
+		if platform, err = resolvePlatform(stub, station, name); err != nil {
+			if platform, err = newMigratedPlatform(stub, station, name); err != nil {
+				return err
+			}
+			platformAsByteArr, err := json.Marshal(platform)
+			if err != nil {
+				return err
+			}
+			if err = stub.PutState(platformKey(station.StationID, platform.PlatformID), platformAsByteArr); err != nil {
+				return err
+			}
+		}
+		locations.platforms[station.StationID+"/"+strings.ToLower(name)] = platform
+	}
+
+	asset.StationID, asset.Trainstation = station.StationID, station.Name
+	asset.PlatformID, asset.Platform = platform.PlatformID, platform.Name
+	return nil
+}
+
+// newMigratedStation returns a station for the name with the first free StationID of: the letters the AssetID starts
+// with, the first three to five letters of the name.
+func newMigratedStation(stub shim.ChaincodeStubInterface, assetID string, name string) (*Station, error) {
+	if name == "" {
+		return nil, errors.New("Asset " + assetID + " has no Trainstation")
+	}
+	letters := strings.Map(func(c rune) rune {
+		if c < 'A' || c > 'Z' {
+			return -1
+		}
+		return c
+	}, strings.ToUpper(name))
+	candidates := []string{strings.TrimRight(assetID, "0123456789")}
+	for n := 3; n <= 5 && n <= len(letters); n++ {
+		candidates = append(candidates, letters[:n])
+	}
+	for _, stationID := range candidates {
+		if !isStationID(stationID) {
+			continue
+		}
+		existing, err := stub.GetState(stationKey(stationID))
+		if err != nil {
+			return nil, err
+		}
+		if existing == nil {
+			return &Station{StationID: stationID, Name: name}, nil
+		}
+	}
+	return nil, errors.New("No free StationID for station " + name + " of asset " + assetID + ", register it with createStation first")
+}
+
+// newMigratedPlatform returns a platform of the station for the name, with the last word of the name as PlatformID
+// or the whole name if that is taken.
+func newMigratedPlatform(stub shim.ChaincodeStubInterface, station *Station, name string) (*Platform, error) {
+	words := strings.Fields(name)
+	if len(words) == 0 {
+		return nil, errors.New("Asset at " + station.Name + " has no Platform")
+	}
+	for _, platformID := range []string{words[len(words)-1], name} {
+		if strings.ContainsAny(platformID, "/~") {
+			continue
+		}
+		existing, err := stub.GetState(platformKey(station.StationID, platformID))
+		if err != nil {
+			return nil, err
+		}
+		if existing == nil {
+			return &Platform{StationID: station.StationID, PlatformID: platformID, Name: name}, nil
+		}
+	}
+	return nil, errors.New("No free PlatformID for platform " + name + " at " + station.Name + ", register it with createPlatform first")
+}
+
+// convertTo moves oldKey to newKey and replaces its value by record.
+func convertTo(moves map[string]string, converted map[string][]byte, oldKey string, newKey string, record interface{}) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	moves[oldKey] = newKey
+	converted[oldKey] = value
+	return nil
+}
+
+// moveState writes the value of oldKey to newKey and deletes oldKey. Missing keys are skipped.
+func moveState(stub shim.ChaincodeStubInterface, oldKey string, newKey string) error {
+	value, err := stub.GetState(oldKey)
+	if err != nil || value == nil {
+		return err
+	}
+	if err = stub.PutState(newKey, value); err != nil {
+		return err
+	}
+	return stub.DelState(oldKey)
+}
+
+// forEachKeyInRange calls f with every key from startKey to endKey and its value. All keys are read before f is
+// called for the first one, so f may change the world state.
+func forEachKeyInRange(stub shim.ChaincodeStubInterface, startKey string, endKey string, f func(key string, value []byte) error) error {
+	resultsIterator, err := stub.RangeQueryState(startKey, endKey)
+	if err != nil {
+		return err
+	}
+	var keys []string
+	var values [][]byte
+	for resultsIterator.HasNext() {
+		key, value, err := resultsIterator.Next()
+		if err != nil {
+			resultsIterator.Close()
+			return err
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+	resultsIterator.Close()
+
+	for i := range keys {
+		if err = f(keys[i], values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// world state written by the first version of the chaincode, which stored everything under flat keys
+var flatKeyFixture = map[string]string{
+	"ticketCounter":    "0002",
+	"escalatorCounter": "0004",
+	"0001": `{"TicketID":"0001","Timestamp":900,"Trainstation":"Dortmund Hbf","Platform":"Gleis 4","Device":"DO0001",` +
+		`"Status":"EINGETROFFEN","TechPart":"Motor","ErrorID":"#2356-102"}`,
+	"0002": `{"TicketID":"0002","Timestamp":950,"Trainstation":"Koeln Hbf","Platform":"Gleis 7","Device":"KO0003",` +
+		`"Status":"ERLEDIGT","RepairStatus":"Reparatur abgeschlossen","ServiceProvider":"Thyssen"}`,
+	"DO0001":     `{"EscalatorID":"DO0001","Trainstation":"dortmund hbf","Platform":"gleis 4","IsWorking":false}`,
+	"KO0003":     `{"EscalatorID":"KO0003","Trainstation":"Koeln Hbf","Platform":"Gleis 7","IsWorking":true}`,
+	"KO0004":     `{"EscalatorID":"KO0004","Trainstation":"Koeln Hbf","Platform":"Gleis 7","IsWorking":true}`,
+	"slathyssen": `{"ServiceProvider":"Thyssen","TimeToArrive":7200,"TimeToRepair":28800,"None":1}`,
+}
+
+// newFlatKeyLedger returns a ledger holding the flat key fixture, with Dortmund Hbf already registered.
+func newFlatKeyLedger(t *testing.T) *testLedger {
+	ledger := &testLedger{t: t, cc: new(SimpleChaincode), stub: newTestStub(2000)}
+	for key, value := range flatKeyFixture {
+		ledger.stub.state[key] = []byte(value)
+	}
+	if err := putStation(ledger.stub, &Station{StationID: "DO", Name: "Dortmund Hbf"}); err != nil {
+		t.Fatal(err)
+	}
+	ledger.stub.state[platformKey("DO", "4")] = []byte(`{"StationID":"DO","PlatformID":"4","Name":"Gleis 4"}`)
+	ledger.stub.commit()
+	return ledger
+}
+
+func TestMigrateFlatKeys(t *testing.T) {
+	ledger := newFlatKeyLedger(t)
+	ledger.mustInvoke("migrateKeys")
+
+	moves := []struct {
+		oldKey, newKey string
+	}{
+		{"ticketCounter", counterKey("ticket")},
+		{"escalatorCounter", counterKey("asset")},
+		{"0001", ticketKey("0001")},
+		{"0002", ticketKey("0002")},
+		{"DO0001", assetKey("DO0001")},
+		{"KO0003", assetKey("KO0003")},
+		{"KO0004", assetKey("KO0004")},
+		{"slathyssen", slaKey("Thyssen")},
+	}
+	for _, move := range moves {
+		if ledger.stub.state[move.oldKey] != nil || ledger.stub.state[move.newKey] == nil {
+			t.Errorf("%s was not moved to %s", move.oldKey, move.newKey)
+		}
+	}
+	if schema := string(ledger.stub.state[configKey("keySchema")]); schema != keySchemaVersion {
+		t.Errorf("key schema = %q, want %q", schema, keySchemaVersion)
+	}
+
+	escalators := []struct {
+		escalatorID  string
+		trainstation string
+		platform     string
+		stationID    string
+		platformID   string
+	}{
+		{"DO0001", "Dortmund Hbf", "Gleis 4", "DO", "4"}, // resolved against the registry
+		{"KO0003", "Koeln Hbf", "Gleis 7", "KO", "7"},    // registered by the migration
+		{"KO0004", "Koeln Hbf", "Gleis 7", "KO", "7"},    // same station, registered only once
+	}
+	for _, want := range escalators {
+		esc := ledger.escalator(want.escalatorID)
+		if esc.Trainstation != want.trainstation || esc.Platform != want.platform || esc.StationID != want.stationID ||
+			esc.PlatformID != want.platformID || esc.CommissioningStatus != commissioningInService ||
+			esc.AssetType != assetTypeEscalator {
+			t.Errorf("escalator %s = %+v", want.escalatorID, esc)
+		}
+	}
+	for _, assetType := range builtinAssetTypes {
+		if _, err := getAssetType(ledger.stub, assetType.AssetType); err != nil {
+			t.Errorf("asset type %s: %v", assetType.AssetType, err)
+		}
+	}
+	if station := ledger.station("KO"); station.Name != "Koeln Hbf" {
+		t.Errorf("station KO = %+v", station)
+	}
+
+	openTickets := []struct {
+		device string
+		want   []string
+	}{
+		{"DO0001", []string{"0001"}},
+		{"KO0003", nil},
+	}
+	for _, test := range openTickets {
+		if ids, err := getOpenTicketIDs(ledger.stub, test.device); err != nil || !reflect.DeepEqual(ids, test.want) {
+			t.Errorf("open tickets of %s = %q, %v, want %q", test.device, ids, err, test.want)
+		}
+	}
+
+	// the migrated ledger keeps working with the namespaced keys
+	ledger.mustInvoke("createTicket", "KO", "7", "KO0004", "Handlauf", "#1200-001", "Handlauf steht")
+	if ticket := ledger.ticket("0003"); ticket.StationID != "KO" || ticket.Trainstation != "Koeln Hbf" {
+		t.Errorf("ticket 0003 = %+v", ticket)
+	}
+	if err := ledger.invoke("migrateKeys"); err == nil {
+		t.Error("migrateKeys ran twice")
+	}
+}
+
+func TestMigrateFlatKeysErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		value string
+	}{
+		{"escalator without station", "XX0005", `{"EscalatorID":"XX0005","Platform":"Gleis 1","IsWorking":true}`},
+		{"escalator without platform", "XX0005", `{"EscalatorID":"XX0005","Trainstation":"Essen Hbf","IsWorking":true}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ledger := newFlatKeyLedger(t)
+			ledger.stub.state[test.key] = []byte(test.value)
+			ledger.stub.commit()
+			if err := ledger.invoke("migrateKeys"); err == nil {
+				t.Fatal("migrateKeys succeeded")
+			}
+			if ledger.stub.state["0001"] == nil || ledger.stub.state[configKey("keySchema")] != nil {
+				t.Error("the failed migration left writes behind")
+			}
+		})
+	}
+}
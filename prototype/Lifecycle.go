@@ -0,0 +1,106 @@
+// Decommissioning and replacement of assets
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// commissioning status of an asset that was taken out of operation for good, see decommissionAsset
+const commissioningDecommissioned = "DECOMMISSIONED"
+
+// Retire an asset. Arguments are the AssetID and the reason. The asset has to be without open tickets; its record and
+// tickets stay on the ledger, but no new tickets are accepted for it.
+func (t *SimpleChaincode) decommissionAsset(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 2 {
+		return nil, errors.New("Wrong number of arguments, must be 2: AssetID and reason")
+	}
+	esc, err := decommission(stub, args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	return nil, putAsset(stub, esc, "decommissionAsset")
+}
+
+// Retire an asset and register its successor of the same type at the same platform. Arguments are the AssetID, the
+// reason and optionally the master data and attributes of the successor as JSON (see updateAsset). Returns the
+// AssetID of the successor.
+func (t *SimpleChaincode) replaceAsset(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, errors.New("Wrong number of arguments, must be 2 or 3: AssetID, reason and optionally master data of the successor as JSON")
+	}
+	esc, err := decommission(stub, args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	station, platform := esc.StationID, esc.PlatformID
+	if station == "" { // asset registered before the station registry
+		station, platform = esc.Trainstation, esc.Platform
+	}
+	createArgs := []string{esc.AssetType, station, platform}
+	if len(args) == 3 {
+		createArgs = append(createArgs, args[2])
+	}
+	successorID, err := t.createAsset(stub, createArgs)
+	if err != nil {
+		return nil, err
+	}
+	successor, err := getAsset(stub, string(successorID))
+	if err != nil {
+		return nil, err
+	}
+	successor.PredecessorID = esc.AssetID
+	esc.SuccessorID = successor.AssetID
+
+	if err = putAsset(stub, successor, "replaceAsset"); err != nil {
+		return nil, err
+	}
+	return successorID, putAsset(stub, esc, "replaceAsset")
+}
+
+// decommission marks the asset as decommissioned without writing it.
+func decommission(stub shim.ChaincodeStubInterface, assetID string, reason string) (*Asset, error) {
+	if len(strings.TrimSpace(reason)) == 0 {
+		return nil, errors.New("A reason is required to decommission an asset")
+	}
+	esc, err := getAsset(stub, assetID)
+	if err != nil {
+		return nil, err
+	}
+	if esc.isDecommissioned() {
+		return nil, errors.New("Asset " + assetID + " is already decommissioned")
+	}
+	// faults and maintenances alike
+	openTicketIDs, err := getOpenTicketIDs(stub, assetID)
+	if err != nil {
+		return nil, err
+	}
+	if len(openTicketIDs) > 0 {
+		return nil, errors.New("Asset " + assetID + " still has the open ticket " + openTicketIDs[0] + ", close or cancel it first")
+	}
+
+	esc.CommissioningStatus = commissioningDecommissioned
+	esc.IsWorking = false
+	esc.DecommissionedAt = getTransactionTime(stub)
+	esc.DecommissionReason = reason
+	return esc, nil
+}
+
+func (esc *Asset) isDecommissioned() bool {
+	return esc.CommissioningStatus == commissioningDecommissioned
+}
+
+// checkTicketDevice rejects new tickets for a decommissioned asset and ErrorIDs missing in the error code catalogue
+// for it, see checkErrorID.
+func checkTicketDevice(stub shim.ChaincodeStubInterface, esc *Asset, errorID string) error {
+	if esc.isDecommissioned() {
+		if esc.SuccessorID != "" {
+			return errors.New("Asset " + esc.AssetID + " is decommissioned, it was replaced by " + esc.SuccessorID)
+		}
+		return errors.New("Asset " + esc.AssetID + " is decommissioned")
+	}
+	return checkErrorID(stub, esc, errorID)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecommissionEscalator(t *testing.T) {
+	tests := []struct {
+		name    string
+		openFor string // device with a ticket that is still open
+		args    []string
+		valid   bool
+	}{
+		{"decommissioned", "", []string{"DO0001", "Abriss des Bahnsteigs"}, true},
+		{"other escalator broken", "BR0002", []string{"DO0001", "Abriss des Bahnsteigs"}, true},
+		{"no reason", "", []string{"DO0001", " "}, false},
+		{"open ticket", "DO0001", []string{"DO0001", "Abriss des Bahnsteigs"}, false},
+		{"unknown escalator", "", []string{"XX0099", "Abriss des Bahnsteigs"}, false},
+		{"missing reason", "", []string{"DO0001"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ledger := newTestLedger(t, 1000)
+			if test.openFor != "" {
+				ledger.reportFailure(test.openFor)
+			}
+			if err := ledger.invoke("decommissionEscalator", test.args...); (err == nil) != test.valid {
+				t.Fatalf("decommissionEscalator%q: err = %v", test.args, err)
+			}
+			esc := ledger.escalator("DO0001")
+			if esc.isDecommissioned() != test.valid {
+				t.Errorf("escalator DO0001 = %+v", esc)
+			}
+			if test.valid && (esc.IsWorking || esc.DecommissionedAt != 1000 || esc.DecommissionReason != test.args[1]) {
+				t.Errorf("escalator DO0001 = %+v", esc)
+			}
+		})
+	}
+}
+
+func TestDecommissionedEscalatorRejectsChanges(t *testing.T) {
+	tests := []struct {
+		function string
+		args     []string
+	}{
+		{"createTicket", []string{"DO", "4", "DO0001", "Motor", "#2356-102", "Totalausfall"}},
+		{"setEscalatorState", []string{"DO0001", "false", "Motor", "#2356-102", "Totalausfall"}},
+		{"setEscalatorState", []string{"DO0001", "true"}},
+		{"updateEscalator", []string{"DO0001", `{"CommissioningStatus":"IN_SERVICE"}`}},
+		{"decommissionEscalator", []string{"DO0001", "Abriss des Bahnsteigs"}},
+		{"replaceEscalator", []string{"DO0001", "Abriss des Bahnsteigs"}},
+	}
+	ledger := newTestLedger(t, 1000)
+	ledger.mustInvoke("decommissionEscalator", "DO0001", "Abriss des Bahnsteigs")
+	for _, test := range tests {
+		if err := ledger.invoke(test.function, test.args...); err == nil {
+			t.Errorf("%s%q was accepted for a decommissioned escalator", test.function, test.args)
+		}
+	}
+	if esc := ledger.escalator("DO0001"); esc.CommissioningStatus != commissioningDecommissioned || esc.SuccessorID != "" {
+		t.Errorf("escalator DO0001 = %+v", esc)
+	}
+}
+
+func TestReplaceEscalator(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		valid     bool
+		model     string // Model of the successor DO0003
+		cancelled bool   // a ticket of DO0001 is cancelled before the replacement
+	}{
+		{"replaced", []string{"DO0001", "Modernisierung"}, true, "", false},
+		{"with master data", []string{"DO0001", "Modernisierung", `{"Manufacturer":"Thyssen","Model":"Velino"}`}, true,
+			"Velino", false},
+		{"after cancelled ticket", []string{"DO0001", "Modernisierung"}, true, "", true},
+		{"invalid master data", []string{"DO0001", "Modernisierung", `{"CommissioningStatus":"ABGEBAUT"}`}, false, "",
+			false},
+		{"no reason", []string{"DO0001", ""}, false, "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ledger := newTestLedger(t, 1000)
+			if test.cancelled {
+				ledger.reportFailure("DO0001")
+				ledger.mustInvoke("cancelTicket", "0001", "FALSE_ALARM")
+			}
+			if err := ledger.invoke("replaceEscalator", test.args...); (err == nil) != test.valid {
+				t.Fatalf("replaceEscalator%q: err = %v", test.args, err)
+			}
+			if !test.valid {
+				if esc := ledger.escalator("DO0001"); esc.isDecommissioned() {
+					t.Errorf("failed replaceEscalator%q decommissioned DO0001", test.args)
+				}
+				if _, err := ledger.query("getEscalator", "DO0003"); err == nil {
+					t.Errorf("failed replaceEscalator%q created a successor", test.args)
+				}
+				return
+			}
+
+			esc, successor := ledger.escalator("DO0001"), ledger.escalator("DO0003")
+			if !esc.isDecommissioned() || esc.SuccessorID != "DO0003" || successor.PredecessorID != "DO0001" {
+				t.Errorf("DO0001 = %+v, DO0003 = %+v", esc, successor)
+			}
+			if successor.StationID != "DO" || successor.PlatformID != "4" || successor.Model != test.model ||
+				successor.isDecommissioned() {
+				t.Errorf("successor DO0003 = %+v", successor)
+			}
+
+			// failures are reported for the successor
+			err := ledger.invoke("createTicket", "DO", "4", "DO0001", "Motor", "#2356-102", "Totalausfall")
+			if err == nil || !strings.Contains(err.Error(), "DO0003") {
+				t.Errorf("createTicket for DO0001: err = %v, want a hint to DO0003", err)
+			}
+			ledger.mustInvoke("createTicket", "DO", "4", "DO0003", "Motor", "#2356-102", "Totalausfall")
+		})
+	}
+}
@@ -0,0 +1,126 @@
+// Station locations and verification of the mechanic's arrival
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// A Position is a point reported by the mechanic's device, in decimal degrees (WGS 84).
+type Position struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// results of the arrival verification in onArrival (Ticket.ArrivalCheck)
+const (
+	arrivalVerified        = "VERIFIED"         // reported position lies within the geofence of the station
+	arrivalOutsideGeofence = "OUTSIDE_GEOFENCE" // reported position lies outside of the geofence, the arrival is flagged
+	arrivalNoPosition      = "NO_POSITION"      // the mechanic did not report a position, the arrival is flagged
+	arrivalNoLocation      = "NO_STATION_LOCATION"
+)
+
+const (
+	defaultGeofenceRadius = 500 // meters
+	earthRadius           = 6371000.0
+)
+
+// Set the coordinates of a registered station. Arguments are the StationID (or name of the station), latitude and
+// longitude in decimal degrees and optionally the radius of the geofence in meters (default 500).
+func (t *SimpleChaincode) setStationLocation(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 3 && len(args) != 4 {
+		return nil, errors.New("Wrong number of arguments, must be 3 or 4: StationID, latitude, longitude and optionally the radius in meters")
+	}
+	position, err := parsePosition(args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	radius := int64(defaultGeofenceRadius)
+	if len(args) == 4 {
+		radius, err = strconv.ParseInt(args[3], 10, 64)
+		if err != nil || radius <= 0 {
+			return nil, errors.New("Radius must be a positive number of meters")
+		}
+	}
+
+	station, err := resolveStation(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	station.Latitude = position.Latitude
+	station.Longitude = position.Longitude
+	station.Radius = radius
+	return nil, putStation(stub, station)
+}
+
+// returns all tickets whose mechanic reported a position outside of the geofence of the Trainstation on arrival or
+// reported no position at all
+func (t *SimpleChaincode) getFlaggedArrivals(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	tickets, err := getTickets(stub)
+	if err != nil {
+		return nil, err
+	}
+	flagged := []Ticket{}
+	for _, ticket := range tickets {
+		if ticket.ArrivalCheck == arrivalOutsideGeofence || ticket.ArrivalCheck == arrivalNoPosition {
+			flagged = append(flagged, ticket)
+		}
+	}
+	return json.Marshal(flagged)
+}
+
+// verifyArrival checks the position reported by the mechanic against the geofence of the ticket's Trainstation and
+// stores the result in the ticket. position is nil if the mechanic did not report one.
+func verifyArrival(stub shim.ChaincodeStubInterface, ticket *Ticket, position *Position) error {
+	ticket.ArrivalPosition = position
+	if position == nil {
+		ticket.ArrivalCheck = arrivalNoPosition
+		return nil
+	}
+	stationIDOrName := ticket.StationID
+	if stationIDOrName == "" { // ticket created before the station registry
+		stationIDOrName = ticket.Trainstation
+	}
+	station, err := resolveStation(stub, stationIDOrName)
+	if err != nil || station.Radius == 0 {
+		ticket.ArrivalCheck = arrivalNoLocation
+		return nil
+	}
+
+	ticket.ArrivalDistance = distance(Position{station.Latitude, station.Longitude}, *position)
+	if ticket.ArrivalDistance <= station.Radius {
+		ticket.ArrivalCheck = arrivalVerified
+	} else {
+		ticket.ArrivalCheck = arrivalOutsideGeofence
+	}
+	return nil
+}
+
+// parsePosition parses latitude and longitude in decimal degrees.
+func parsePosition(latitude string, longitude string) (*Position, error) {
+	lat, err := strconv.ParseFloat(strings.TrimSpace(latitude), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return nil, errors.New("Latitude must be a number between -90 and 90")
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(longitude), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return nil, errors.New("Longitude must be a number between -180 and 180")
+	}
+	return &Position{Latitude: lat, Longitude: lon}, nil
+}
+
+// distance returns the great circle distance between two positions in meters (haversine formula).
+func distance(a Position, b Position) int64 {
+	lat1 := a.Latitude * math.Pi / 180
+	lat2 := b.Latitude * math.Pi / 180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return int64(math.Floor(2*earthRadius*math.Asin(math.Sqrt(h)) + 0.5))
+}
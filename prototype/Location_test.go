@@ -0,0 +1,97 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b Position
+		want int64
+	}{
+		{Position{0, 0}, Position{0, 0}, 0},
+		{Position{0, 0}, Position{0, 1}, 111195},
+		{Position{0, 0}, Position{1, 0}, 111195},
+		{Position{51.5178, 7.4593}, Position{51.5188, 7.4593}, 111},
+		{Position{51.5178, 7.4593}, Position{53.0830, 8.8136}, 196895},
+	}
+	for _, test := range tests {
+		if d := distance(test.a, test.b); d != test.want || distance(test.b, test.a) != d {
+			t.Errorf("distance(%v, %v) = %d, want %d", test.a, test.b, d, test.want)
+		}
+	}
+}
+
+func TestSetStationLocation(t *testing.T) {
+	tests := []struct {
+		args   []string
+		valid  bool
+		radius int64 // radius of Dortmund Hbf afterwards
+	}{
+		{[]string{"DO", "51.5178", "7.4593"}, true, defaultGeofenceRadius},
+		{[]string{"dortmund hbf", "51.5178", "7.4593", "300"}, true, 300},
+		{[]string{"DO", "51.5178", "7.4593", "0"}, false, 300},
+		{[]string{"DO", "91", "7.4593"}, false, 300},
+		{[]string{"DO", "51.5178", "Ost"}, false, 300},
+		{[]string{"DO", "51.5178"}, false, 300},
+		{[]string{"Essen Hbf", "51.4513", "7.0141"}, false, 300},
+	}
+	ledger := newTestLedger(t, 1000)
+	for _, test := range tests {
+		if err := ledger.invoke("setStationLocation", test.args...); (err == nil) != test.valid {
+			t.Errorf("setStationLocation%q: err = %v", test.args, err)
+		}
+		if station := ledger.station("DO"); station.Radius != test.radius || station.Latitude != 51.5178 {
+			t.Errorf("after setStationLocation%q: %+v, want radius %d", test.args, station, test.radius)
+		}
+	}
+	if station := ledger.station("BR"); station.Radius != 0 {
+		t.Errorf("location of BR was set: %+v", station)
+	}
+}
+
+func TestVerifyArrival(t *testing.T) {
+	tests := []struct {
+		name     string
+		device   string
+		position []string // latitude and longitude passed to onArrival
+		check    string
+		distance int64
+		valid    bool
+	}{
+		{"at the station", "DO0001", []string{"51.5180", "7.4590"}, arrivalVerified, 30, true},
+		{"next to the station", "DO0001", []string{"51.5188", "7.4593"}, arrivalVerified, 111, true},
+		{"outside", "DO0001", []string{"51.5278", "7.4593"}, arrivalOutsideGeofence, 1112, true},
+		{"no position", "DO0001", nil, arrivalNoPosition, 0, true},
+		{"station without location", "BR0002", []string{"53.0830", "8.8136"}, arrivalNoLocation, 0, true},
+		{"invalid position", "DO0001", []string{"51.5180", "200"}, "", 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ledger := newTestLedger(t, 1000)
+			ledger.mustInvoke("setStationLocation", "DO", "51.5178", "7.4593", "200")
+			ledger.reportFailure(test.device)
+			ledger.advanceTicket("0001", stateOnTheWay)
+			args := append([]string{"0001", "Stufe gebrochen", "2h"}, test.position...)
+			if err := ledger.invoke("onArrival", args...); (err == nil) != test.valid {
+				t.Fatalf("onArrival%q: err = %v", args, err)
+			}
+			ticket := ledger.ticket("0001")
+			if ticket.ArrivalCheck != test.check || ticket.ArrivalDistance != test.distance {
+				t.Errorf("ArrivalCheck = %q, ArrivalDistance = %d, want %q, %d", ticket.ArrivalCheck,
+					ticket.ArrivalDistance, test.check, test.distance)
+			}
+
+			result, err := ledger.query("getFlaggedArrivals")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var flagged []Ticket
+			ledger.unmarshal(result, &flagged)
+			want := test.check == arrivalOutsideGeofence || test.check == arrivalNoPosition
+			if (len(flagged) == 1) != want {
+				t.Errorf("getFlaggedArrivals = %d tickets, want flagged %v", len(flagged), want)
+			}
+		})
+	}
+}
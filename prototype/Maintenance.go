@@ -0,0 +1,365 @@
+// Preventive maintenance plans
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// ticket kinds (Ticket.Kind)
+const (
+	kindFault       = ""            // reactive fault report, scored against the SLA of the provider
+	kindMaintenance = "MAINTENANCE" // planned maintenance generated from a MaintenancePlan, never counted in any SLA
+)
+
+// results of the due date check of a closed maintenance ticket (Ticket.DueResult)
+const (
+	dueOnTime = "ON_TIME"
+	dueLate   = "LATE"
+	dueMissed = "MISSED" // the ticket was cancelled, the maintenance was not done
+)
+
+// default for the time in seconds before the due date at which generateMaintenanceTickets creates the ticket
+const defaultMaintenanceLeadTime = 7 * 24 * 3600
+
+// horizon of getMaintenanceSchedule in seconds if none is given
+const defaultScheduleHorizon = 30 * 24 * 3600
+
+// A MaintenancePlan schedules the recurring preventive maintenance of an asset.
+type MaintenancePlan struct {
+	PlanID          string
+	AssetID         string
+	ServiceProvider string   // provider responsible for the maintenance, the generated tickets are assigned to it
+	Interval        int64    // seconds between two maintenances
+	Tasks           []string // task list copied to every generated ticket
+	LeadTime        int64    // seconds before the due date at which the ticket is generated
+	NextDue         int64    // due date of the next maintenance without ticket yet
+	LastTicketID    string   // ticket generated most recently from the plan
+	OnTime          int64    // finished maintenance tickets by due date
+	Late            int64    // finished maintenance tickets after their due date
+	Missed          int64    // cancelled maintenance tickets
+}
+
+// A ScheduledMaintenance is an upcoming or overdue maintenance, see getMaintenanceSchedule.
+type ScheduledMaintenance struct {
+	PlanID          string
+	AssetID         string
+	ServiceProvider string
+	DueDate         int64
+	TicketID        string // open ticket of the maintenance, empty if it is not generated yet
+	Overdue         bool
+	OverdueBy       int64 // seconds past DueDate
+}
+
+// Create a maintenance plan. Arguments are the AssetID, the responsible ServiceProvider, the interval (seconds or a
+// duration like "720h"), the task list as JSON array and optionally the first due date (Unix seconds or YYYY-MM-DD,
+// one interval from now by default) and the lead time (default one week). Returns the PlanID.
+func (t *SimpleChaincode) createMaintenancePlan(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) < 4 || len(args) > 6 {
+		return nil, errors.New("Wrong number of arguments, must be 4 to 6: AssetID, ServiceProvider, interval, tasks as JSON array and optionally first due date and lead time")
+	}
+	asset, err := getAsset(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if asset.isDecommissioned() {
+		return nil, errors.New("Asset " + args[0] + " is decommissioned")
+	}
+	if _, err = getServiceLevelAgreement(stub, args[1]); err != nil {
+		return nil, errors.New("ServiceProvider " + args[1] + " has no SLA")
+	}
+	interval, err := parseRepairDuration(args[2])
+	if err != nil || interval <= 0 {
+		return nil, errors.New("Interval " + args[2] + " must be a positive number of seconds or a duration like 720h")
+	}
+	var tasks []string
+	if err = json.Unmarshal([]byte(args[3]), &tasks); err != nil || len(tasks) == 0 {
+		return nil, errors.New("Tasks must be a non-empty JSON array of strings")
+	}
+
+	plan := MaintenancePlan{
+		AssetID:         asset.AssetID,
+		ServiceProvider: args[1],
+		Interval:        interval,
+		Tasks:           tasks,
+		LeadTime:        defaultMaintenanceLeadTime,
+		NextDue:         getTransactionTime(stub) + interval,
+	}
+	if len(args) >= 5 && args[4] != "" {
+		if plan.NextDue, err = parseTime(args[4]); err != nil {
+			return nil, err
+		}
+	}
+	if len(args) == 6 {
+		if plan.LeadTime, err = parseRepairDuration(args[5]); err != nil || plan.LeadTime < 0 {
+			return nil, errors.New("Lead time " + args[5] + " must be a number of seconds or a duration like 168h")
+		}
+	}
+	seq, err := nextSequence(stub, counterKey("maintenancePlan"))
+	if err != nil {
+		return nil, err
+	}
+	plan.PlanID = "MP" + leftPad2Len(strconv.FormatInt(seq, 10), "0", 4)
+
+	return []byte(plan.PlanID), putMaintenancePlan(stub, &plan)
+}
+
+// Generate the tickets of all maintenances that are due within their lead time at the time of the transaction. A plan
+// gets no new ticket as long as its last one is open, and none for decommissioned assets. Returns the TicketIDs of the
+// generated tickets as JSON array.
+func (t *SimpleChaincode) generateMaintenanceTickets(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	plans, err := getMaintenancePlans(stub)
+	if err != nil {
+		return nil, err
+	}
+	now := getTransactionTime(stub)
+	generated := []string{}
+	for i := range plans {
+		plan := &plans[i]
+		if plan.NextDue-plan.LeadTime > now {
+			continue
+		}
+		open, err := plan.openTicket(stub)
+		if err != nil {
+			return nil, err
+		}
+		asset, err := getAsset(stub, plan.AssetID)
+		if err != nil {
+			return nil, err
+		}
+		if open != nil || asset.isDecommissioned() {
+			continue
+		}
+
+		ticketID, err := createMaintenanceTicket(stub, plan, asset)
+		if err != nil {
+			return nil, err
+		}
+		generated = append(generated, ticketID)
+
+		// cycles missed entirely are not made up for, the next maintenance is due one interval after the last due date
+		// that is not in the past
+		plan.LastTicketID = ticketID
+		plan.NextDue += plan.Interval
+		for plan.NextDue <= now {
+			plan.NextDue += plan.Interval
+		}
+		if err = putMaintenancePlan(stub, plan); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(generated)
+}
+
+// returns all maintenance plans, ordered by PlanID. Input is optionally an AssetID to return only its plans.
+func (t *SimpleChaincode) getMaintenancePlans(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) > 1 {
+		return nil, errors.New("Wrong number of arguments, must be 0 or 1: optionally an AssetID")
+	}
+	plans, err := getMaintenancePlans(stub)
+	if err != nil {
+		return nil, err
+	}
+	result := []MaintenancePlan{}
+	for _, plan := range plans {
+		if len(args) == 0 || plan.AssetID == args[0] {
+			result = append(result, plan)
+		}
+	}
+	return json.Marshal(result)
+}
+
+// returns the open maintenance tickets, overdue or not, and the maintenances due within the horizon that have no
+// ticket yet, ordered by due date. Plans of decommissioned assets are left out. Arguments are optionally the horizon
+// (seconds or a duration like "720h", 30 days by default) and a ServiceProvider to restrict the result to its
+// maintenances.
+func (t *SimpleChaincode) getMaintenanceSchedule(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) > 2 {
+		return nil, errors.New("Wrong number of arguments, must be 0 to 2: optionally horizon and ServiceProvider")
+	}
+	horizon := int64(defaultScheduleHorizon)
+	if len(args) >= 1 && args[0] != "" {
+		var err error
+		if horizon, err = parseRepairDuration(args[0]); err != nil {
+			return nil, errors.New("Horizon " + args[0] + " must be a number of seconds or a duration like 720h")
+		}
+	}
+	plans, err := getMaintenancePlans(stub)
+	if err != nil {
+		return nil, err
+	}
+	tickets, err := getTickets(stub)
+	if err != nil {
+		return nil, err
+	}
+	now := getTransactionTime(stub)
+
+	schedule := []ScheduledMaintenance{}
+	for _, plan := range plans {
+		if len(args) == 2 && !strings.EqualFold(plan.ServiceProvider, args[1]) {
+			continue
+		}
+		if plan.NextDue > now+horizon {
+			continue
+		}
+		asset, err := getAsset(stub, plan.AssetID)
+		if err != nil {
+			return nil, err
+		}
+		if !asset.isDecommissioned() {
+			schedule = append(schedule, newScheduledMaintenance(&plan, plan.NextDue, "", now))
+		}
+	}
+	for i := range tickets {
+		ticket := &tickets[i]
+		if ticket.Kind != kindMaintenance || !ticket.isOpen() {
+			continue
+		}
+		if len(args) == 2 && !strings.EqualFold(ticket.ServiceProvider, args[1]) {
+			continue
+		}
+		plan := MaintenancePlan{PlanID: ticket.PlanID, AssetID: ticket.Device, ServiceProvider: ticket.ServiceProvider}
+		schedule = append(schedule, newScheduledMaintenance(&plan, ticket.DueDate, ticket.TicketID, now))
+	}
+	sort.Sort(byDueDate(schedule))
+	return json.Marshal(schedule)
+}
+
+// createMaintenanceTicket creates the ticket of the next maintenance of the plan, assigned to its provider.
+func createMaintenanceTicket(stub shim.ChaincodeStubInterface, plan *MaintenancePlan, asset *Asset) (string, error) {
+	idAsString, _ := createID(stub, "ticket")
+	var ticket = Ticket{
+		TicketID:        idAsString,
+		Timestamp:       getTransactionTime(stub),
+		Trainstation:    asset.Trainstation,
+		Platform:        asset.Platform,
+		StationID:       asset.StationID,
+		PlatformID:      asset.PlatformID,
+		Device:          asset.AssetID,
+		Status:          statusNew,
+		ServiceProvider: plan.ServiceProvider,
+		Kind:            kindMaintenance,
+		PlanID:          plan.PlanID,
+		DueDate:         plan.NextDue,
+		Tasks:           plan.Tasks,
+	}
+	if err := ticket.transition("generateMaintenanceTickets"); err != nil {
+		return "", err
+	}
+	return ticket.TicketID, putTicket(stub, &ticket, "generateMaintenanceTickets")
+}
+
+// checkDueDate records whether a finished maintenance ticket was done by its due date, or that a cancelled one was
+// missed, and counts the result on its plan.
+func checkDueDate(stub shim.ChaincodeStubInterface, ticket *Ticket) error {
+	switch {
+	case ticket.currentState() == stateCancelled:
+		ticket.DueResult = dueMissed
+	case ticket.FinalRepairTime > ticket.DueDate:
+		ticket.DueResult = dueLate
+	default:
+		ticket.DueResult = dueOnTime
+	}
+	plan, err := getMaintenancePlan(stub, ticket.PlanID)
+	if err != nil {
+		return err
+	}
+	switch ticket.DueResult {
+	case dueOnTime:
+		plan.OnTime++
+	case dueLate:
+		plan.Late++
+	default:
+		plan.Missed++
+	}
+	return putMaintenancePlan(stub, plan)
+}
+
+// openTicket returns the open ticket generated from the plan, or nil if there is none.
+func (plan *MaintenancePlan) openTicket(stub shim.ChaincodeStubInterface) (*Ticket, error) {
+	if plan.LastTicketID == "" {
+		return nil, nil
+	}
+	ticket, err := getTicket(stub, plan.LastTicketID)
+	if err != nil || !ticket.isOpen() {
+		return nil, err
+	}
+	return ticket, nil
+}
+
+// isPlanned reports whether the ticket is a planned maintenance rather than a fault report.
+func (ticket *Ticket) isPlanned() bool {
+	return ticket.Kind == kindMaintenance
+}
+
+func newScheduledMaintenance(plan *MaintenancePlan, dueDate int64, ticketID string, now int64) ScheduledMaintenance {
+	scheduled := ScheduledMaintenance{
+		PlanID:          plan.PlanID,
+		AssetID:         plan.AssetID,
+		ServiceProvider: plan.ServiceProvider,
+		DueDate:         dueDate,
+		TicketID:        ticketID,
+	}
+	if now > dueDate {
+		scheduled.Overdue = true
+		scheduled.OverdueBy = now - dueDate
+	}
+	return scheduled
+}
+
+// byDueDate sorts scheduled maintenances by due date, then by PlanID.
+type byDueDate []ScheduledMaintenance
+
+func (s byDueDate) Len() int      { return len(s) }
+func (s byDueDate) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byDueDate) Less(i, j int) bool {
+	if s[i].DueDate != s[j].DueDate {
+		return s[i].DueDate < s[j].DueDate
+	}
+	return s[i].PlanID < s[j].PlanID
+}
+
+func getMaintenancePlans(stub shim.ChaincodeStubInterface) ([]MaintenancePlan, error) {
+	var plans []MaintenancePlan
+	err := forEachInRange(stub, maintenancePlanKey(""), maintenancePlanKey("~"), func(planAsByteArr []byte) error {
+		var plan MaintenancePlan
+		if err := json.Unmarshal(planAsByteArr, &plan); err != nil {
+			return err
+		}
+		plans = append(plans, plan)
+		return nil
+	})
+	return plans, err
+}
+
+func getMaintenancePlan(stub shim.ChaincodeStubInterface, planID string) (*MaintenancePlan, error) {
+	planAsByteArr, err := stub.GetState(maintenancePlanKey(planID))
+	if err != nil {
+		return nil, err
+	}
+	if planAsByteArr == nil {
+		return nil, errors.New("No maintenance plan found for PlanID " + planID)
+	}
+	plan := new(MaintenancePlan)
+	if err = json.Unmarshal(planAsByteArr, plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+func putMaintenancePlan(stub shim.ChaincodeStubInterface, plan *MaintenancePlan) error {
+	planAsByteArr, err := json.Marshal(plan)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(maintenancePlanKey(plan.PlanID), planAsByteArr)
+}
+
+func maintenancePlanKey(planID string) string {
+	return "maintenancePlan/" + planID
+}
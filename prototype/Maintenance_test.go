@@ -0,0 +1,225 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// maintenanceTasks is the task list of the plans created in the tests.
+const maintenanceTasks = `["Stufen pruefen","Handlauf schmieren"]`
+
+func (ledger *testLedger) maintenancePlan(planID string) MaintenancePlan {
+	result, err := ledger.query("getMaintenancePlans")
+	if err != nil {
+		ledger.t.Fatal(err)
+	}
+	var plans []MaintenancePlan
+	ledger.unmarshal(result, &plans)
+	for _, plan := range plans {
+		if plan.PlanID == planID {
+			return plan
+		}
+	}
+	ledger.t.Fatalf("maintenance plan %s not found: %s", planID, result)
+	return MaintenancePlan{}
+}
+
+func TestCreateMaintenancePlan(t *testing.T) {
+	tests := []struct {
+		args     []string
+		valid    bool
+		nextDue  int64
+		leadTime int64
+	}{
+		{[]string{"DO0001", "Thyssen", "720h", maintenanceTasks}, true, 1000 + 2592000, defaultMaintenanceLeadTime},
+		{[]string{"DO0001", "thyssen", "86400", maintenanceTasks, "1000000", "48h"}, true, 1000000, 172800},
+		{[]string{"DO0001", "Thyssen", "720h", maintenanceTasks, "", "1h"}, true, 1000 + 2592000, 3600},
+		{[]string{"XX0099", "Thyssen", "720h", maintenanceTasks}, false, 0, 0},
+		{[]string{"BR0002", "Thyssen", "720h", maintenanceTasks}, false, 0, 0}, // decommissioned
+		{[]string{"DO0001", "Kone", "720h", maintenanceTasks}, false, 0, 0},
+		{[]string{"DO0001", "Thyssen", "0", maintenanceTasks}, false, 0, 0},
+		{[]string{"DO0001", "Thyssen", "monatlich", maintenanceTasks}, false, 0, 0},
+		{[]string{"DO0001", "Thyssen", "720h", "[]"}, false, 0, 0},
+		{[]string{"DO0001", "Thyssen", "720h", "Stufen pruefen"}, false, 0, 0},
+		{[]string{"DO0001", "Thyssen", "720h", maintenanceTasks, "morgen"}, false, 0, 0},
+		{[]string{"DO0001", "Thyssen", "720h", maintenanceTasks, "", "-1h"}, false, 0, 0},
+		{[]string{"DO0001", "Thyssen", "720h"}, false, 0, 0},
+	}
+	for _, test := range tests {
+		ledger := newTestLedger(t, 1000)
+		ledger.mustInvoke("decommissionEscalator", "BR0002", "Abriss des Bahnsteigs")
+		if err := ledger.invoke("createMaintenancePlan", test.args...); (err == nil) != test.valid {
+			t.Errorf("createMaintenancePlan%q: err = %v", test.args, err)
+			continue
+		}
+		if !test.valid {
+			continue
+		}
+		plan := ledger.maintenancePlan("MP0001")
+		if plan.AssetID != "DO0001" || plan.NextDue != test.nextDue || plan.LeadTime != test.leadTime ||
+			len(plan.Tasks) != 2 {
+			t.Errorf("createMaintenancePlan%q: %+v", test.args, plan)
+		}
+	}
+}
+
+func TestGenerateMaintenanceTickets(t *testing.T) {
+	// the maintenance is due at 1000000 and every 30 days after, tickets are generated one week before
+	tests := []struct {
+		time     int64
+		finish   bool     // the generated ticket is finished before generating again
+		want     []string // generated TicketIDs
+		nextDue  int64
+		lastTime int64 // Timestamp of the plan's last ticket
+	}{
+		{300000, false, []string{}, 1000000, 0},
+		{395200, false, []string{"0001"}, 3592000, 395200},
+		{500000, false, []string{}, 3592000, 395200}, // ticket 0001 is still open
+		{2000000, true, []string{}, 3592000, 395200},
+		{2987200, false, []string{"0002"}, 6184000, 2987200},
+		{12000000, true, []string{"0003"}, 13960000, 12000000}, // missed cycles are skipped
+	}
+	ledger := newTestLedger(t, 1000)
+	ledger.mustInvoke("createMaintenancePlan", "DO0001", "Thyssen", "720h", maintenanceTasks, "1000000")
+	for _, test := range tests {
+		ledger.stub.time = test.time
+		plan := ledger.maintenancePlan("MP0001")
+		if test.finish {
+			ledger.advanceTicket(plan.LastTicketID, stateDone)
+		}
+		result, err := ledger.cc.Invoke(ledger.stub, "generateMaintenanceTickets", nil)
+		if err != nil {
+			t.Fatalf("generateMaintenanceTickets at %d: %v", test.time, err)
+		}
+		ledger.stub.commit()
+		var generated []string
+		ledger.unmarshal(result, &generated)
+		if !reflect.DeepEqual(generated, test.want) {
+			t.Errorf("generateMaintenanceTickets at %d = %q, want %q", test.time, generated, test.want)
+		}
+		plan = ledger.maintenancePlan("MP0001")
+		if plan.NextDue != test.nextDue || test.lastTime != 0 && ledger.ticket(plan.LastTicketID).Timestamp != test.lastTime {
+			t.Errorf("after generateMaintenanceTickets at %d: %+v", test.time, plan)
+		}
+	}
+
+	ticket := ledger.ticket("0003")
+	if ticket.Kind != kindMaintenance || ticket.PlanID != "MP0001" || ticket.DueDate != 6184000 ||
+		ticket.ServiceProvider != "Thyssen" || ticket.currentState() != stateAssigned || len(ticket.Tasks) != 2 {
+		t.Errorf("ticket 0003 = %+v", ticket)
+	}
+}
+
+func TestMaintenanceDueDate(t *testing.T) {
+	tests := []struct {
+		name     string
+		finishAt int64 // time the ticket is finished, 0 to cancel it
+		want     string
+		counts   [3]int64 // OnTime, Late and Missed of the plan
+	}{
+		{"on time", 900000, dueOnTime, [3]int64{1, 0, 0}},
+		{"on the due date", 1000000, dueOnTime, [3]int64{1, 0, 0}},
+		{"late", 1000001, dueLate, [3]int64{0, 1, 0}},
+		{"cancelled", 0, dueMissed, [3]int64{0, 0, 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ledger := newTestLedger(t, 1000)
+			ledger.mustInvoke("createMaintenancePlan", "DO0001", "Thyssen", "720h", maintenanceTasks, "1000000")
+			ledger.stub.time = 400000
+			ledger.mustInvoke("generateMaintenanceTickets")
+			sla := ledger.sla("Thyssen")
+
+			if test.finishAt == 0 {
+				ledger.mustInvoke("cancelTicket", "0001", "OPERATOR_ERROR")
+			} else {
+				ledger.advanceTicket("0001", stateAwaitingAccept)
+				ticket := ledger.ticket("0001")
+				ticket.FinalRepairTime = test.finishAt
+				if err := putTicket(ledger.stub, ticket, "finishRepair"); err != nil {
+					t.Fatal(err)
+				}
+				ledger.stub.commit()
+				ledger.mustInvoke("acceptRepair", "0001")
+			}
+
+			ticket := ledger.ticket("0001")
+			if ticket.DueResult != test.want || ticket.SLAResult != "" {
+				t.Errorf("DueResult = %q, SLAResult = %q, want %q", ticket.DueResult, ticket.SLAResult, test.want)
+			}
+			plan := ledger.maintenancePlan("MP0001")
+			if counts := [3]int64{plan.OnTime, plan.Late, plan.Missed}; counts != test.counts {
+				t.Errorf("plan OnTime, Late, Missed = %v, want %v", counts, test.counts)
+			}
+			if after := ledger.sla("Thyssen"); after != sla {
+				t.Errorf("maintenance changed the SLA of Thyssen: %+v, before %+v", after, sla)
+			}
+		})
+	}
+}
+
+func TestMaintenanceTicketIsNoFault(t *testing.T) {
+	ledger := newTestLedger(t, 1000)
+	ledger.mustInvoke("createMaintenancePlan", "DO0001", "Thyssen", "720h", maintenanceTasks, "1000000")
+	ledger.stub.time = 400000
+	ledger.mustInvoke("generateMaintenanceTickets")
+
+	// an open maintenance does not mean the escalator is broken
+	ledger.mustInvoke("setEscalatorState", "DO0001", "true")
+	if !ledger.escalatorWorking("DO0001") {
+		t.Error("DO0001 is not working")
+	}
+	// a fault gets a ticket of its own instead of being attached to the maintenance
+	ledger.mustInvoke("setEscalatorState", "DO0001", "false", "Motor", "#2356-102", "Totalausfall")
+	if fault := ledger.ticket("0002"); fault.Kind != kindFault || len(ledger.ticket("0001").Occurrences) != 0 {
+		t.Errorf("fault ticket 0002 = %+v", fault)
+	}
+	// neither can be left open when the escalator is decommissioned
+	ledger.mustInvoke("cancelTicket", "0002", "FALSE_ALARM")
+	if err := ledger.invoke("decommissionEscalator", "DO0001", "Abriss des Bahnsteigs"); err == nil {
+		t.Error("DO0001 was decommissioned with an open maintenance ticket")
+	}
+	ledger.mustInvoke("cancelTicket", "0001", "OPERATOR_ERROR")
+	ledger.mustInvoke("decommissionEscalator", "DO0001", "Abriss des Bahnsteigs")
+}
+
+func TestMaintenanceSchedule(t *testing.T) {
+	ledger := newTestLedger(t, 1000)
+	ledger.mustInvoke("createMaintenancePlan", "DO0001", "Thyssen", "720h", maintenanceTasks, "1000000")
+	ledger.mustInvoke("createMaintenancePlan", "BR0002", "Otis", "720h", maintenanceTasks, "2000000")
+	ledger.stub.time = 400000
+	ledger.mustInvoke("generateMaintenanceTickets")
+	ledger.stub.time = 1100000
+
+	tests := []struct {
+		args []string
+		want []ScheduledMaintenance
+	}{
+		{nil, []ScheduledMaintenance{
+			{"MP0001", "DO0001", "Thyssen", 1000000, "0001", true, 100000},
+			{"MP0002", "BR0002", "Otis", 2000000, "", false, 0},
+			{"MP0001", "DO0001", "Thyssen", 3592000, "", false, 0},
+		}},
+		{[]string{"24h"}, []ScheduledMaintenance{
+			{"MP0001", "DO0001", "Thyssen", 1000000, "0001", true, 100000},
+		}},
+		{[]string{"", "otis"}, []ScheduledMaintenance{
+			{"MP0002", "BR0002", "Otis", 2000000, "", false, 0},
+		}},
+		{[]string{"", "Schindler"}, []ScheduledMaintenance{}},
+	}
+	for _, test := range tests {
+		result, err := ledger.query("getMaintenanceSchedule", test.args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var schedule []ScheduledMaintenance
+		ledger.unmarshal(result, &schedule)
+		if !reflect.DeepEqual(schedule, test.want) {
+			t.Errorf("getMaintenanceSchedule%q = %+v, want %+v", test.args, schedule, test.want)
+		}
+	}
+	if _, err := ledger.query("getMaintenanceSchedule", "bald"); err == nil {
+		t.Error("getMaintenanceSchedule accepted the horizon bald")
+	}
+}
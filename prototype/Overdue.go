@@ -0,0 +1,115 @@
+// Overdue tickets
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// An OverdueTicket is an open ticket that is already past at least one of the agreed times of its SLA.
+type OverdueTicket struct {
+	TicketID        string
+	ServiceProvider string // provider whose SLA is breached, see Ticket.scoredProvider
+	Status          string
+	RepairStatus    string
+	Elapsed         int64 // seconds on the SLA clock, without approved pauses
+	Breaches        []SLABreach
+}
+
+// A SLABreach names the agreed time of an SLA that was exceeded, the level of the violation and by how many seconds
+// the time was exceeded.
+type SLABreach struct {
+	Threshold string // "TimeToArrive" or "TimeToRepair"
+	Level     string // "Light" or "Severe"
+	OverdueBy int64
+}
+
+// returns all open tickets that are past the TimeToArrive or TimeToRepair of their SLA at the time of the transaction
+func (t *SimpleChaincode) getOverdueTickets(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	overdue, err := findOverdueTickets(stub, "")
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(overdue)
+}
+
+// same as getOverdueTickets, restricted to the tickets scored against the SLA of the given ServiceProvider
+func (t *SimpleChaincode) getOverdueTicketsByServiceProvider(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Wrong number of arguments, must be 1: ServiceProvider")
+	}
+	overdue, err := findOverdueTickets(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(overdue)
+}
+
+// findOverdueTickets compares every open ticket with the SLA of its provider. Tickets that are not assigned to a
+// provider yet, or to a provider without SLA, and maintenance tickets are never overdue. If serviceProvider is not empty, only its tickets are checked.
+func findOverdueTickets(stub shim.ChaincodeStubInterface, serviceProvider string) ([]OverdueTicket, error) {
+	tickets, err := getTickets(stub)
+	if err != nil {
+		return nil, err
+	}
+	now := getTransactionTime(stub)
+	slas := map[string]*ServiceLevelAgreement{}
+
+	overdue := []OverdueTicket{}
+	for i := range tickets {
+		ticket := &tickets[i]
+		provider := ticket.scoredProvider()
+		if !ticket.isOpen() || provider == "" || ticket.isPlanned() {
+			continue
+		}
+		if serviceProvider != "" && !strings.EqualFold(provider, serviceProvider) {
+			continue
+		}
+		sla, ok := slas[strings.ToLower(provider)]
+		if !ok {
+			sla, _ = getServiceLevelAgreement(stub, provider) // providers without SLA are skipped
+			slas[strings.ToLower(provider)] = sla
+		}
+		if sla == nil {
+			continue
+		}
+
+		// the clock stops when the provider finishes the repair, even if it is not accepted yet
+		end := now
+		if ticket.FinalRepairTime != 0 {
+			end = ticket.FinalRepairTime
+		}
+		start := ticket.slaStart()
+		elapsed := end - start - ticket.pausedBetween(start, end)
+		var breaches []SLABreach
+		if ticket.TimeOfArrival == 0 && elapsed > sla.TimeToArrive {
+			breaches = append(breaches, newSLABreach("TimeToArrive", elapsed-sla.TimeToArrive, severeArrivalDelay))
+		}
+		if elapsed > sla.TimeToRepair {
+			breaches = append(breaches, newSLABreach("TimeToRepair", elapsed-sla.TimeToRepair, severeRepairDelay))
+		}
+		if len(breaches) == 0 {
+			continue
+		}
+		overdue = append(overdue, OverdueTicket{
+			TicketID:        ticket.TicketID,
+			ServiceProvider: provider,
+			Status:          ticket.Status,
+			RepairStatus:    ticket.RepairStatus,
+			Elapsed:         elapsed,
+			Breaches:        breaches,
+		})
+	}
+	return overdue, nil
+}
+
+func newSLABreach(threshold string, overdueBy int64, severeDelay int64) SLABreach {
+	level := slaLight
+	if overdueBy > severeDelay {
+		level = slaSevere
+	}
+	return SLABreach{Threshold: threshold, Level: level, OverdueBy: overdueBy}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOverdueTickets(t *testing.T) {
+	ledger := newTestLedger(t, 1000)
+	ledger.reportFailure("DO0001")
+	ledger.advanceTicket("0001", stateOnTheWay)
+	ledger.reportFailure("BR0002")
+	ledger.mustInvoke("assignTicket", "0002", "Otis")
+	ledger.mustInvoke("assignMechanic", "0002", "Eva")
+	ledger.mustInvoke("startJourney", "0002")
+	ledger.stub.time = 1100
+	ledger.mustInvoke("onArrival", "0002", "Handlauf gerissen", "4h")
+	ledger.reportFailure("DO0001") // not assigned, never overdue
+
+	tests := []struct {
+		after    int64 // seconds after the ticket creation
+		provider string
+		want     map[string][]SLABreach
+	}{
+		{7000, "", map[string][]SLABreach{}},
+		{8000, "", map[string][]SLABreach{"0001": {{"TimeToArrive", slaLight, 800}}}},
+		{20000, "", map[string][]SLABreach{"0001": {{"TimeToArrive", slaSevere, 12800}}}},
+		{30000, "", map[string][]SLABreach{
+			"0001": {{"TimeToArrive", slaSevere, 22800}, {"TimeToRepair", slaLight, 1200}},
+			"0002": {{"TimeToRepair", slaLight, 1200}},
+		}},
+		{30000, "otis", map[string][]SLABreach{"0002": {{"TimeToRepair", slaLight, 1200}}}},
+	}
+	for _, test := range tests {
+		ledger.stub.time = 1000 + test.after
+		var result []byte
+		var err error
+		if test.provider == "" {
+			result, err = ledger.query("getOverdueTickets")
+		} else {
+			result, err = ledger.query("getOverdueTicketsByServiceProvider", test.provider)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var overdue []OverdueTicket
+		ledger.unmarshal(result, &overdue)
+		breaches := map[string][]SLABreach{}
+		for _, ticket := range overdue {
+			breaches[ticket.TicketID] = ticket.Breaches
+		}
+		if !reflect.DeepEqual(breaches, test.want) {
+			t.Errorf("overdue after %ds for %q: %+v, want %+v", test.after, test.provider, breaches, test.want)
+		}
+	}
+}
+
+func TestOverdueWhileAwaitingAcceptance(t *testing.T) {
+	tests := []struct {
+		state TicketState // state of the ticket 20000s after its creation
+		want  int         // overdue tickets another 20000s later
+	}{
+		{stateReporting, 1},
+		{stateAwaitingAccept, 0},
+	}
+	for _, test := range tests {
+		ledger := newTestLedger(t, 1000)
+		ledger.reportFailure("DO0001")
+		ledger.stub.time = 21000
+		ledger.advanceTicket("0001", test.state)
+		ledger.stub.time = 41000
+		result, err := ledger.query("getOverdueTickets")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var overdue []OverdueTicket
+		ledger.unmarshal(result, &overdue)
+		if len(overdue) != test.want {
+			t.Errorf("in state %s: overdue %s", test.state, result)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+// SLA clock pauses
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// A Pause is an interval in which the SLA clock of a ticket was stopped, e.g. while waiting for spare parts.
+// Only approved pauses are subtracted in the SLA evaluation.
+type Pause struct {
+	Reason   string // reason code from pauseReasons
+	Comment  string
+	Start    int64
+	End      int64  // 0 as long as the pause lasts
+	Decision string // "PENDING", "APPROVED" or "REJECTED", set by decidePause
+}
+
+const (
+	pausePending  = "PENDING"
+	pauseApproved = "APPROVED"
+	pauseRejected = "REJECTED"
+)
+
+// catalogue of reason codes accepted by pauseTicket
+var pauseReasons = map[string]string{
+	"WAITING_FOR_PARTS": "waiting for the delivery of spare parts",
+	"ACCESS_RESTRICTED": "no access to the escalator, e.g. station closed by police",
+	"OPERATOR_REQUEST":  "repair postponed at the request of the station operator",
+}
+
+// Stop the SLA clock of a ticket. Arguments are the TicketID, a reason code from pauseReasons and an optional comment.
+// The pause has to be approved with decidePause before it counts in the SLA evaluation.
+func (t *SimpleChaincode) pauseTicket(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, errors.New("Wrong number of arguments, must be 2 or 3: TicketID, reason code and optionally a comment")
+	}
+	reason := strings.ToUpper(args[1])
+	if _, ok := pauseReasons[reason]; !ok {
+		return nil, errors.New("Unknown pause reason " + args[1] + ", see getPauseReasons")
+	}
+
+	ticket, err := getTicket(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if err = ticket.transition("pauseTicket"); err != nil {
+		return nil, err
+	}
+	pause := Pause{
+		Reason:   reason,
+		Start:    getTransactionTime(stub),
+		Decision: pausePending,
+	}
+	if len(args) == 3 {
+		pause.Comment = args[2]
+	}
+	ticket.Pauses = append(ticket.Pauses, pause)
+
+	return nil, putTicket(stub, ticket, "pauseTicket")
+}
+
+// Restart the SLA clock of a paused ticket. Input is the TicketID.
+func (t *SimpleChaincode) resumeTicket(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Wrong number of arguments, must be 1: TicketID")
+	}
+
+	ticket, err := getTicket(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if err = ticket.transition("resumeTicket"); err != nil {
+		return nil, err
+	}
+	ticket.Pauses[len(ticket.Pauses)-1].End = getTransactionTime(stub)
+	ticket.PausedDuration = ticket.pausedBetween(ticket.slaStart(), ticket.Pauses[len(ticket.Pauses)-1].End)
+
+	return nil, putTicket(stub, ticket, "resumeTicket")
+}
+
+// Approve or reject a pause of a ticket. Arguments are the TicketID, the number of the pause (starting at 1, in the
+// order the pauses were requested) and "true" to approve or "false" to reject it. A pause can only be decided once, and
+// only by the station operator.
+func (t *SimpleChaincode) decidePause(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 3 {
+		return nil, errors.New("Wrong number of arguments, must be 3: TicketID, number of the pause and true/false")
+	}
+	if role, err := getCallerRole(stub); err != nil || role != roleOperator {
+		return nil, errors.New("Pauses can only be decided by the station operator")
+	}
+	approved, err := strconv.ParseBool(args[2])
+	if err != nil {
+		return nil, errors.New("Decision must be true (approve) or false (reject)")
+	}
+
+	ticket, err := getTicket(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if err = ticket.transition("decidePause"); err != nil {
+		return nil, err
+	}
+	number, err := strconv.Atoi(args[1])
+	if err != nil || number < 1 || number > len(ticket.Pauses) {
+		return nil, errors.New("Ticket " + ticket.TicketID + " has no pause number " + args[1])
+	}
+	if decision := ticket.Pauses[number-1].Decision; decision != pausePending {
+		return nil, errors.New("Pause " + args[1] + " of ticket " + ticket.TicketID + " is already decided: " + decision)
+	}
+	if approved {
+		ticket.Pauses[number-1].Decision = pauseApproved
+	} else {
+		ticket.Pauses[number-1].Decision = pauseRejected
+	}
+	ticket.PausedDuration = ticket.pausedBetween(ticket.slaStart(), getTransactionTime(stub))
+
+	return nil, putTicket(stub, ticket, "decidePause")
+}
+
+// returns the catalogue of reason codes accepted by pauseTicket
+func (t *SimpleChaincode) getPauseReasons(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	return json.Marshal(pauseReasons)
+}
+
+// isPaused reports whether the SLA clock of the ticket is currently stopped.
+func (ticket *Ticket) isPaused() bool {
+	return len(ticket.Pauses) > 0 && ticket.Pauses[len(ticket.Pauses)-1].End == 0
+}
+
+// hasPendingPause reports whether the ticket has a pause that is not decided yet.
+func (ticket *Ticket) hasPendingPause() bool {
+	for _, pause := range ticket.Pauses {
+		if pause.Decision == pausePending {
+			return true
+		}
+	}
+	return false
+}
+
+// pausedBetween returns the number of seconds between from and to that are covered by approved pauses. A pause that
+// still lasts is counted up to to.
+func (ticket *Ticket) pausedBetween(from int64, to int64) int64 {
+	var paused int64
+	for _, pause := range ticket.Pauses {
+		if pause.Decision != pauseApproved {
+			continue
+		}
+		start, end := pause.Start, pause.End
+		if end == 0 || end > to {
+			end = to
+		}
+		if start < from {
+			start = from
+		}
+		if end > start {
+			paused += end - start
+		}
+	}
+	return paused
+}
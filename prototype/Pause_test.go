@@ -0,0 +1,122 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestPausedBetween(t *testing.T) {
+	ticket := &Ticket{Pauses: []Pause{
+		{Start: 100, End: 200, Decision: pauseApproved},
+		{Start: 300, End: 400, Decision: pauseRejected},
+		{Start: 500, End: 600, Decision: pausePending},
+		{Start: 700, Decision: pauseApproved},
+	}}
+	tests := []struct {
+		from, to int64
+		want     int64
+	}{
+		{0, 1000, 400},
+		{150, 1000, 350},
+		{0, 150, 50},
+		{200, 700, 0},
+		{0, 750, 150},
+	}
+	for _, test := range tests {
+		if paused := ticket.pausedBetween(test.from, test.to); paused != test.want {
+			t.Errorf("pausedBetween(%d, %d) = %d, want %d", test.from, test.to, paused, test.want)
+		}
+	}
+}
+
+// pauseStep is an invoke on ticket 0001 at the given number of seconds after its creation.
+type pauseStep struct {
+	after    int64
+	role     string
+	function string
+	args     []string // arguments after the TicketID
+}
+
+func TestPauseSLA(t *testing.T) {
+	pause := []pauseStep{
+		{1000, roleDispatcher, "pauseTicket", []string{"WAITING_FOR_PARTS", "Motor bestellt"}},
+		{9000, roleDispatcher, "resumeTicket", nil},
+	}
+	tests := []struct {
+		name     string
+		steps    []pauseStep
+		provider string
+		result   string
+	}{
+		{"without pause", nil, "Thyssen", slaLight},
+		{"approved pause", append(pause, pauseStep{9500, roleOperator, "decidePause", []string{"1", "true"}}),
+			"Thyssen", slaNone},
+		{"rejected pause", append(pause, pauseStep{9500, roleOperator, "decidePause", []string{"1", "false"}}),
+			"Thyssen", slaLight},
+		{"approved while paused", []pauseStep{pause[0], {2000, roleOperator, "decidePause", []string{"1", "true"}},
+			pause[1]}, "Thyssen", slaNone},
+		{"pause after handover by fault", append([]pauseStep{{500, roleOperator, "reassignTicket",
+			[]string{"Otis", "PROVIDER_FAULT"}}}, append(pause, pauseStep{9500, roleOperator, "decidePause",
+			[]string{"1", "true"}})...), "Thyssen", slaNone},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ledger := newTestLedger(t, 1000)
+			ledger.reportFailure("DO0001")
+			ledger.advanceTicket("0001", stateOnTheWay)
+			before := ledger.sla(test.provider)
+			for _, step := range test.steps {
+				ledger.stub.time = 1000 + step.after
+				ledger.stub.attributes["role"] = step.role
+				ledger.mustInvoke(step.function, append([]string{"0001"}, step.args...)...)
+				ledger.advanceTicket("0001", stateOnTheWay)
+			}
+
+			// the mechanic arrives 10000s after the ticket creation, the agreed time is 7200s
+			ledger.stub.time = 11000
+			ledger.advanceTicket("0001", stateDone)
+			if result := ledger.ticket("0001").SLAResult; result != test.result {
+				t.Errorf("SLAResult = %s, want %s", result, test.result)
+			}
+			after := ledger.sla(test.provider)
+			after.count(test.result, -1)
+			if after != before {
+				t.Errorf("SLA of %s was not counted as %s", test.provider, test.result)
+			}
+		})
+	}
+}
+
+func TestPendingPauseBlocksEvaluation(t *testing.T) {
+	ledger := newTestLedger(t, 1000)
+	ledger.reportFailure("DO0001")
+	ledger.advanceTicket("0001", stateOnTheWay)
+	ledger.mustInvoke("pauseTicket", "0001", "ACCESS_RESTRICTED")
+	if err := ledger.invoke("onArrival", "0001", "Bahnsteig gesperrt", "1h"); err == nil {
+		t.Error("onArrival was allowed while the ticket is paused")
+	}
+	ledger.mustInvoke("resumeTicket", "0001")
+	ledger.advanceTicket("0001", stateAwaitingAccept)
+	if err := ledger.invoke("acceptRepair", "0001"); err == nil {
+		t.Fatal("acceptRepair was allowed with an undecided pause")
+	}
+
+	tests := []struct {
+		role  string
+		args  []string
+		valid bool
+	}{
+		{roleDispatcher, []string{"0001", "1", "true"}, false},
+		{"", []string{"0001", "1", "true"}, false},
+		{roleOperator, []string{"0001", "2", "true"}, false},
+		{roleOperator, []string{"0001", "1", "vielleicht"}, false},
+		{roleOperator, []string{"0001", "1", "false"}, true},
+		{roleOperator, []string{"0001", "1", "true"}, false}, // already decided
+	}
+	for _, test := range tests {
+		ledger.stub.attributes["role"] = test.role
+		if err := ledger.invoke("decidePause", test.args...); (err == nil) != test.valid {
+			t.Errorf("decidePause%q as %q: err = %v", test.args, test.role, err)
+		}
+	}
+	ledger.mustInvoke("acceptRepair", "0001")
+}
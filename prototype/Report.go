@@ -0,0 +1,145 @@
+// Final repair reports
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// A RepairReport is the structured final report of a repair, submitted by writeFinalReport as JSON.
+type RepairReport struct {
+	RootCause        string // category from rootCauses
+	PartsReplaced    []ReplacedPart
+	Labour           []LabourTime
+	FollowUpRequired bool
+	Text             string
+}
+
+// A ReplacedPart is a spare part that was built in during the repair.
+type ReplacedPart struct {
+	PartNumber string
+	Quantity   int64
+	Depot      string // depot of the service provider the part was taken from
+}
+
+// LabourTime holds the hours a mechanic worked on the repair.
+type LabourTime struct {
+	Mechanic string
+	Hours    float64
+}
+
+// catalogue of root cause categories accepted in a RepairReport
+var rootCauses = map[string]string{
+	"MECHANICAL":      "mechanical defect, e.g. chain, step or handrail",
+	"ELECTRICAL":      "electrical defect, e.g. motor, wiring or sensors",
+	"CONTROL_SYSTEM":  "failure of the controller or its software",
+	"WEAR":            "regular wear and tear",
+	"VANDALISM":       "damage caused by vandalism",
+	"ENVIRONMENT":     "external influence, e.g. water, dirt or heat",
+	"OPERATING_ERROR": "incorrect operation of the escalator",
+	"UNKNOWN":         "root cause could not be determined",
+	"PREVENTIVE":      "planned maintenance, no defect found",
+}
+
+// RootCauseSummary aggregates the reports of all tickets with the same root cause.
+type RootCauseSummary struct {
+	RootCause   string
+	Tickets     int64
+	TicketIDs   []string
+	LabourHours float64
+	Parts       map[string]int64 // quantity replaced per part number
+	FollowUps   int64            // number of reports that require a follow-up
+}
+
+// validate checks a submitted report and normalizes its root cause.
+func (report *RepairReport) validate() error {
+	report.RootCause = strings.ToUpper(report.RootCause)
+	if _, ok := rootCauses[report.RootCause]; !ok {
+		return errors.New("Unknown root cause " + report.RootCause + ", see getRootCauses")
+	}
+	for _, part := range report.PartsReplaced {
+		if part.PartNumber == "" || part.Quantity <= 0 {
+			return errors.New("Every replaced part needs a PartNumber and a positive Quantity")
+		}
+	}
+	if len(report.Labour) == 0 {
+		return errors.New("The report needs the labour hours of at least one mechanic")
+	}
+	for _, labour := range report.Labour {
+		if labour.Mechanic == "" || labour.Hours <= 0 {
+			return errors.New("Every labour entry needs a Mechanic and a positive number of Hours")
+		}
+	}
+	return nil
+}
+
+// parseRepairReport decodes and validates a report submitted as JSON.
+func parseRepairReport(reportAsJSON string) (*RepairReport, error) {
+	report := new(RepairReport)
+	if err := json.Unmarshal([]byte(reportAsJSON), report); err != nil {
+		return nil, errors.New("The final report must be a JSON encoded RepairReport: " + err.Error())
+	}
+	if err := report.validate(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// returns the catalogue of root cause categories accepted in a RepairReport
+func (t *SimpleChaincode) getRootCauses(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	return json.Marshal(rootCauses)
+}
+
+// aggregates the final reports of all tickets by root cause. Optionally takes a ServiceProvider to only include its tickets.
+func (t *SimpleChaincode) getReportsByRootCause(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) > 1 {
+		return nil, errors.New("Wrong number of arguments, must be 0 or 1: optionally a ServiceProvider")
+	}
+
+	tickets, err := getTickets(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := map[string]*RootCauseSummary{}
+	for _, ticket := range tickets {
+		if ticket.Report == nil || ticket.Status == statusCancelled {
+			continue
+		}
+		if len(args) == 1 && !strings.EqualFold(ticket.ServiceProvider, args[0]) {
+			continue
+		}
+		summary, ok := summaries[ticket.Report.RootCause]
+		if !ok {
+			summary = &RootCauseSummary{RootCause: ticket.Report.RootCause, TicketIDs: []string{}, Parts: map[string]int64{}}
+			summaries[ticket.Report.RootCause] = summary
+		}
+		summary.Tickets++
+		summary.TicketIDs = append(summary.TicketIDs, ticket.TicketID)
+		for _, labour := range ticket.Report.Labour {
+			summary.LabourHours += labour.Hours
+		}
+		for _, part := range ticket.Report.PartsReplaced {
+			summary.Parts[part.PartNumber] += part.Quantity
+		}
+		if ticket.Report.FollowUpRequired {
+			summary.FollowUps++
+		}
+	}
+
+	// return the summaries ordered by root cause, map iteration order differs between peers
+	var causes []string
+	for cause := range summaries {
+		causes = append(causes, cause)
+	}
+	sort.Strings(causes)
+	result := []*RootCauseSummary{}
+	for _, cause := range causes {
+		result = append(result, summaries[cause])
+	}
+	return json.Marshal(result)
+}
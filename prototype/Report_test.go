@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseRepairReport(t *testing.T) {
+	tests := []struct {
+		report string
+		err    string // part of the expected error, empty if the report is valid
+	}{
+		{repairReportJSON, ""},
+		{`{"RootCause":"vandalism","PartsReplaced":[{"PartNumber":"RTM-X 64","Quantity":1}],
+			"Labour":[{"Mechanic":"Hans","Hours":1.5}]}`, ""},
+		{"Stufe getauscht", "JSON encoded RepairReport"},
+		{`{"RootCause":"PECH","Labour":[{"Mechanic":"Hans","Hours":2}]}`, "Unknown root cause PECH"},
+		{`{"RootCause":"WEAR"}`, "labour hours"},
+		{`{"RootCause":"WEAR","Labour":[{"Mechanic":"Hans","Hours":0}]}`, "positive number of Hours"},
+		{`{"RootCause":"WEAR","Labour":[{"Mechanic":"Hans","Hours":1}],"PartsReplaced":[{"PartNumber":"RTM-X 64"}]}`,
+			"positive Quantity"},
+	}
+	for _, test := range tests {
+		report, err := parseRepairReport(test.report)
+		if test.err == "" && (err != nil || report.RootCause != strings.ToUpper(report.RootCause)) {
+			t.Errorf("parseRepairReport(%s) = %+v, %v", test.report, report, err)
+		}
+		if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("parseRepairReport(%s): err = %v, want %q", test.report, err, test.err)
+		}
+	}
+}
+
+func TestReportsByRootCause(t *testing.T) {
+	ledger := newTestLedger(t, 1000)
+	reports := []struct {
+		device, provider, report string
+	}{
+		{"DO0001", "Thyssen", repairReportJSON},
+		{"BR0002", "Otis", `{"RootCause":"VANDALISM","PartsReplaced":[{"PartNumber":"RTM-X 64","Quantity":2,"Depot":"Bremen"}],
+			"Labour":[{"Mechanic":"Eva","Hours":3},{"Mechanic":"Jan","Hours":1}],"FollowUpRequired":true}`},
+		{"DO0001", "Otis", `{"RootCause":"WEAR","Labour":[{"Mechanic":"Eva","Hours":0.5}]}`},
+	}
+	ledger.mustInvoke("receiveParts", "Otis", "Bremen", "RTM-X 64", "2")
+	for i, report := range reports {
+		ticketID := fmt.Sprintf("%04d", i+1)
+		ledger.reportFailure(report.device)
+		ledger.mustInvoke("assignTicket", ticketID, report.provider)
+		ledger.advanceTicket(ticketID, stateRepairing)
+		ledger.mustInvoke("writeFinalReport", ticketID, report.report)
+		ledger.advanceTicket(ticketID, stateDone)
+	}
+
+	tests := []struct {
+		provider string
+		want     []RootCauseSummary
+	}{
+		{"", []RootCauseSummary{
+			{RootCause: "VANDALISM", Tickets: 1, LabourHours: 4, FollowUps: 1},
+			{RootCause: "WEAR", Tickets: 2, LabourHours: 2.5},
+		}},
+		{"otis", []RootCauseSummary{
+			{RootCause: "VANDALISM", Tickets: 1, LabourHours: 4, FollowUps: 1},
+			{RootCause: "WEAR", Tickets: 1, LabourHours: 0.5},
+		}},
+	}
+	for _, test := range tests {
+		var result []byte
+		var err error
+		if test.provider == "" {
+			result, err = ledger.query("getReportsByRootCause")
+		} else {
+			result, err = ledger.query("getReportsByRootCause", test.provider)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var summaries []RootCauseSummary
+		ledger.unmarshal(result, &summaries)
+		if len(summaries) != len(test.want) {
+			t.Fatalf("getReportsByRootCause(%q) = %s", test.provider, result)
+		}
+		for i, summary := range summaries {
+			want := test.want[i]
+			if summary.RootCause != want.RootCause || summary.Tickets != want.Tickets ||
+				summary.LabourHours != want.LabourHours || summary.FollowUps != want.FollowUps {
+				t.Errorf("getReportsByRootCause(%q)[%d] = %+v, want %+v", test.provider, i, summary, want)
+			}
+		}
+		if test.provider == "" && summaries[0].Parts["RTM-X 64"] != 2 {
+			t.Errorf("parts of VANDALISM = %v", summaries[0].Parts)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+// Station and platform registry
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// A Station is a train station with escalators and other assets. Its StationID never changes and is the prefix of the
+// AssetIDs of the assets at the station.
+type Station struct {
+	StationID string // e.g. "DO"
+	Name      string // e.g. "Dortmund Hbf", unique regardless of case
+	Latitude  float64
+	Longitude float64
+	Radius    int64 // geofence around the station in meters, 0 as long as no location is set, see setStationLocation
+}
+
+// A Platform belongs to exactly one Station. PlatformIDs are unique within their station.
+type Platform struct {
+	StationID  string
+	PlatformID string // e.g. "4"
+	Name       string // e.g. "Gleis 4", unique within the station regardless of case
+}
+
+// Register a station. Arguments are the StationID (2 to 5 letters) and the name of the station.
+func (t *SimpleChaincode) createStation(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 2 {
+		return nil, errors.New("Wrong number of arguments, must be 2: StationID and Name")
+	}
+	stationID := strings.ToUpper(args[0])
+	if !isStationID(stationID) {
+		return nil, errors.New("StationID " + args[0] + " must consist of 2 to 5 letters")
+	}
+	name := strings.TrimSpace(args[1])
+	if name == "" {
+		return nil, errors.New("Name of the station must not be empty")
+	}
+	if existing, _ := resolveStation(stub, stationID); existing != nil {
+		return nil, errors.New("StationID " + stationID + " is already used by " + existing.Name)
+	}
+	if existing, _ := resolveStation(stub, name); existing != nil {
+		return nil, errors.New("Station " + name + " already exists as " + existing.StationID)
+	}
+
+	return nil, putStation(stub, &Station{StationID: stationID, Name: name})
+}
+
+// Register a platform of a station. Arguments are the StationID (or name of the station), the PlatformID and the name
+// of the platform.
+func (t *SimpleChaincode) createPlatform(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 3 {
+		return nil, errors.New("Wrong number of arguments, must be 3: StationID, PlatformID and Name")
+	}
+	station, err := resolveStation(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	platformID := strings.TrimSpace(args[1])
+	if platformID == "" || strings.ContainsAny(platformID, "/~") {
+		return nil, errors.New("PlatformID must not be empty or contain / or ~")
+	}
+	name := strings.TrimSpace(args[2])
+	if name == "" {
+		return nil, errors.New("Name of the platform must not be empty")
+	}
+	if existing, _ := resolvePlatform(stub, station, platformID); existing != nil {
+		return nil, errors.New("PlatformID " + platformID + " is already used at " + station.Name + " by " + existing.Name)
+	}
+	if existing, _ := resolvePlatform(stub, station, name); existing != nil {
+		return nil, errors.New("Platform " + name + " already exists at " + station.Name + " as " + existing.PlatformID)
+	}
+
+	platformAsByteArr, err := json.Marshal(Platform{StationID: station.StationID, PlatformID: platformID, Name: name})
+	if err != nil {
+		return nil, err
+	}
+	return nil, stub.PutState(platformKey(station.StationID, platformID), platformAsByteArr)
+}
+
+// returns all registered stations, ordered by StationID
+func (t *SimpleChaincode) getStations(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	return getRangeAsJSONArray(stub, stationKey(""), stationKey("~"))
+}
+
+// returns the platforms of a station, ordered by PlatformID. Input is the StationID or the name of the station.
+func (t *SimpleChaincode) getPlatforms(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Wrong number of arguments, must be 1: StationID")
+	}
+	station, err := resolveStation(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	return getRangeAsJSONArray(stub, platformKey(station.StationID, ""), platformKey(station.StationID, "~"))
+}
+
+// resolveStation finds a registered station by its StationID or, case insensitive, by its name.
+func resolveStation(stub shim.ChaincodeStubInterface, stationIDOrName string) (*Station, error) {
+	stationIDOrName = strings.TrimSpace(stationIDOrName)
+	if isStationID(strings.ToUpper(stationIDOrName)) {
+		stationAsByteArr, err := stub.GetState(stationKey(strings.ToUpper(stationIDOrName)))
+		if err != nil {
+			return nil, err
+		}
+		if stationAsByteArr != nil {
+			station := new(Station)
+			return station, json.Unmarshal(stationAsByteArr, station)
+		}
+	}
+
+	var found *Station
+	err := forEachInRange(stub, stationKey(""), stationKey("~"), func(stationAsByteArr []byte) error {
+		var station Station
+		if err := json.Unmarshal(stationAsByteArr, &station); err != nil {
+			return err
+		}
+		if found == nil && strings.EqualFold(station.Name, stationIDOrName) {
+			found = &station
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, errors.New("Unknown station " + stationIDOrName + ", see getStations")
+	}
+	return found, nil
+}
+
+// resolvePlatform finds a platform of the station by its PlatformID or, case insensitive, by its name.
+func resolvePlatform(stub shim.ChaincodeStubInterface, station *Station, platformIDOrName string) (*Platform, error) {
+	platformIDOrName = strings.TrimSpace(platformIDOrName)
+	if !strings.ContainsAny(platformIDOrName, "/~") {
+		platformAsByteArr, err := stub.GetState(platformKey(station.StationID, platformIDOrName))
+		if err != nil {
+			return nil, err
+		}
+		if platformAsByteArr != nil {
+			platform := new(Platform)
+			return platform, json.Unmarshal(platformAsByteArr, platform)
+		}
+	}
+
+	var found *Platform
+	err := forEachInRange(stub, platformKey(station.StationID, ""), platformKey(station.StationID, "~"), func(platformAsByteArr []byte) error {
+		var platform Platform
+		if err := json.Unmarshal(platformAsByteArr, &platform); err != nil {
+			return err
+		}
+		if found == nil && strings.EqualFold(platform.Name, platformIDOrName) {
+			found = &platform
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, errors.New("Unknown platform " + platformIDOrName + " at " + station.Name + ", see getPlatforms")
+	}
+	return found, nil
+}
+
+// resolveLocation validates a Trainstation and Platform given as IDs or names against the registry.
+func resolveLocation(stub shim.ChaincodeStubInterface, trainstation string, platform string) (*Station, *Platform, error) {
+	station, err := resolveStation(stub, trainstation)
+	if err != nil {
+		return nil, nil, err
+	}
+	p, err := resolvePlatform(stub, station, platform)
+	if err != nil {
+		return nil, nil, err
+	}
+	return station, p, nil
+}
+
+func putStation(stub shim.ChaincodeStubInterface, station *Station) error {
+	stationAsByteArr, err := json.Marshal(station)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(stationKey(station.StationID), stationAsByteArr)
+}
+
+func isStationID(s string) bool {
+	if len(s) < 2 || len(s) > 5 {
+		return false
+	}
+	for _, c := range s {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+func stationKey(stationID string) string {
+	return "station/" + stationID
+}
+
+func platformKey(stationID string, platformID string) string {
+	return "platform/" + stationID + "/" + platformID
+}
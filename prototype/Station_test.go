@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+)
+
+// station returns the registered station with the given StationID.
+func (ledger *testLedger) station(stationID string) Station {
+	result, err := ledger.query("getStations")
+	if err != nil {
+		ledger.t.Fatal(err)
+	}
+	var stations []Station
+	ledger.unmarshal(result, &stations)
+	for _, station := range stations {
+		if station.StationID == stationID {
+			return station
+		}
+	}
+	ledger.t.Fatalf("station %s is not registered: %s", stationID, result)
+	return Station{}
+}
+
+func TestStationRegistry(t *testing.T) {
+	tests := []struct {
+		function string
+		args     []string
+		valid    bool
+	}{
+		{"createStation", []string{"es", "Essen Hbf"}, true},
+		{"createStation", []string{"ES", "Essen Süd"}, false},
+		{"createStation", []string{"ESS", "essen hbf"}, false},
+		{"createStation", []string{"E", "Essen West"}, false},
+		{"createStation", []string{"ES1", "Essen West"}, false},
+		{"createStation", []string{"ESW", " "}, false},
+		{"createPlatform", []string{"ES", "2", "Gleis 2"}, true},
+		{"createPlatform", []string{"Essen Hbf", "3", "Gleis 3"}, true},
+		{"createPlatform", []string{"ES", "2", "Gleis 2a"}, false},
+		{"createPlatform", []string{"ES", "2a", "gleis 2"}, false},
+		{"createPlatform", []string{"ES", "2/3", "Gleis 2/3"}, false},
+		{"createPlatform", []string{"MS", "1", "Gleis 1"}, false},
+		{"createPlatform", []string{"DO", "2", "Gleis 2"}, true},
+	}
+	ledger := newTestLedger(t, 1000)
+	for _, test := range tests {
+		if err := ledger.invoke(test.function, test.args...); (err == nil) != test.valid {
+			t.Errorf("%s%q: err = %v", test.function, test.args, err)
+		}
+	}
+
+	result, err := ledger.query("getPlatforms", "essen hbf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var platforms []Platform
+	ledger.unmarshal(result, &platforms)
+	if len(platforms) != 2 || platforms[0].PlatformID != "2" || platforms[1].Name != "Gleis 3" {
+		t.Errorf("getPlatforms(essen hbf) = %s", result)
+	}
+	if station := ledger.station("ES"); station.Name != "Essen Hbf" {
+		t.Errorf("station ES = %+v", station)
+	}
+}
+
+func TestRegisteredLocations(t *testing.T) {
+	tests := []struct {
+		function string
+		args     []string
+		valid    bool
+	}{
+		{"createEscalator", []string{"DO", "Gleis 4"}, true},
+		{"createEscalator", []string{"Dortmund Hbf", "5"}, false},
+		{"createEscalator", []string{"Dortmund", "4"}, false},
+		{"createTicket", []string{"DO", "4", "DO0001", "Motor", "#2356-102", "Totalausfall"}, true},
+		{"createTicket", []string{"dortmund hbf", "gleis 4", "DO0003", "Motor", "#2356-102", "Totalausfall"}, true},
+		{"createTicket", []string{"BR", "1", "DO0001", "Motor", "#2356-102", "Totalausfall"}, false},
+		{"createTicket", []string{"BR", "Gleis 2", "BR0002", "Motor", "#2356-102", "Totalausfall"}, false},
+		{"createTicket", []string{"BR", "1", "Aufzug 7", "Motor", "#2356-102", "Totalausfall"}, false},
+	}
+	ledger := newTestLedger(t, 1000)
+	for _, test := range tests {
+		if err := ledger.invoke(test.function, test.args...); (err == nil) != test.valid {
+			t.Errorf("%s%q: err = %v", test.function, test.args, err)
+		}
+	}
+
+	esc := ledger.escalator("DO0003")
+	if esc.Trainstation != "Dortmund Hbf" || esc.Platform != "Gleis 4" || esc.StationID != "DO" || esc.PlatformID != "4" {
+		t.Errorf("escalator DO0003 = %+v", esc)
+	}
+	ticket := ledger.ticket("0002")
+	if ticket.Trainstation != "Dortmund Hbf" || ticket.Platform != "Gleis 4" || ticket.StationID != "DO" ||
+		ticket.PlatformID != "4" {
+		t.Errorf("ticket 0002 = %+v", ticket)
+	}
+}
@@ -0,0 +1,172 @@
+// In-memory chaincode stub for the unit tests
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// testStub keeps the world state of a test in memory. It implements the stub functions the chaincode uses, calling any
+// other one panics.
+//
+// Like the peer, it does not show the writes of the running transaction to range queries: RangeQueryState reads the
+// state as of the last commit, GetState also sees the own writes.
+type testStub struct {
+	shim.ChaincodeStubInterface
+	state      map[string][]byte // state including the writes of the running transaction
+	committed  map[string][]byte // state as of the last commit
+	time       int64             // transaction time in Unix seconds
+	attributes map[string]string // attributes of the caller's certificate
+}
+
+func newTestStub(time int64) *testStub {
+	return &testStub{state: map[string][]byte{}, committed: map[string][]byte{}, time: time,
+		attributes: map[string]string{}}
+}
+
+// commit ends the running transaction, its writes become visible to range queries.
+func (stub *testStub) commit() {
+	stub.committed = copyState(stub.state)
+}
+
+// rollback discards the writes of the running transaction.
+func (stub *testStub) rollback() {
+	stub.state = copyState(stub.committed)
+}
+
+func copyState(state map[string][]byte) map[string][]byte {
+	copied := make(map[string][]byte, len(state))
+	for key, value := range state {
+		copied[key] = value
+	}
+	return copied
+}
+
+func (stub *testStub) GetState(key string) ([]byte, error) {
+	return stub.state[key], nil
+}
+
+func (stub *testStub) PutState(key string, value []byte) error {
+	if key == "" {
+		return errors.New("Key must not be empty")
+	}
+	stub.state[key] = value
+	return nil
+}
+
+func (stub *testStub) DelState(key string) error {
+	delete(stub.state, key)
+	return nil
+}
+
+// RangeQueryState returns the committed keys from startKey to endKey, both inclusive, in key order.
+func (stub *testStub) RangeQueryState(startKey string, endKey string) (shim.StateRangeQueryIteratorInterface, error) {
+	iterator := &testIterator{state: stub.committed}
+	for key := range stub.committed {
+		if key >= startKey && key <= endKey {
+			iterator.keys = append(iterator.keys, key)
+		}
+	}
+	sort.Strings(iterator.keys)
+	return iterator, nil
+}
+
+func (stub *testStub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	return &timestamp.Timestamp{Seconds: stub.time}, nil
+}
+
+func (stub *testStub) GetTxID() string {
+	return "tx"
+}
+
+func (stub *testStub) ReadCertAttribute(attributeName string) ([]byte, error) {
+	value, ok := stub.attributes[attributeName]
+	if !ok {
+		return nil, errors.New("No attribute " + attributeName)
+	}
+	return []byte(value), nil
+}
+
+func (stub *testStub) GetCallerCertificate() ([]byte, error) {
+	return nil, nil
+}
+
+type testIterator struct {
+	keys  []string
+	state map[string][]byte
+}
+
+func (iterator *testIterator) HasNext() bool {
+	return len(iterator.keys) > 0
+}
+
+func (iterator *testIterator) Next() (string, []byte, error) {
+	key := iterator.keys[0]
+	iterator.keys = iterator.keys[1:]
+	return key, iterator.state[key], nil
+}
+
+func (iterator *testIterator) Close() error {
+	return nil
+}
+
+// testLedger runs invokes and queries against a testStub, each one as a transaction of its own.
+type testLedger struct {
+	t    *testing.T
+	cc   *SimpleChaincode
+	stub *testStub
+}
+
+// newTestLedger returns a ledger with the world state of a new ledger, see Init.
+func newTestLedger(t *testing.T, time int64) *testLedger {
+	ledger := &testLedger{t: t, cc: new(SimpleChaincode), stub: newTestStub(time)}
+	if _, err := ledger.cc.Init(ledger.stub, "init", nil); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	ledger.stub.commit()
+	return ledger
+}
+
+// invoke calls function in a transaction of its own. A failing transaction leaves no writes behind.
+func (ledger *testLedger) invoke(function string, args ...string) error {
+	_, err := ledger.cc.Invoke(ledger.stub, function, args)
+	if err != nil {
+		ledger.stub.rollback()
+		return err
+	}
+	ledger.stub.commit()
+	return nil
+}
+
+func (ledger *testLedger) mustInvoke(function string, args ...string) {
+	if err := ledger.invoke(function, args...); err != nil {
+		ledger.t.Fatalf("%s%q: %v", function, args, err)
+	}
+}
+
+func (ledger *testLedger) query(function string, args ...string) ([]byte, error) {
+	result, err := ledger.cc.Query(ledger.stub, function, args)
+	ledger.stub.rollback()
+	return result, err
+}
+
+// ticket reads a ticket as of the last commit.
+func (ledger *testLedger) ticket(ticketID string) *Ticket {
+	ticket, err := getTicket(ledger.stub, ticketID)
+	if err != nil {
+		ledger.t.Fatal(err)
+	}
+	return ticket
+}
+
+// unmarshal decodes a query result into v.
+func (ledger *testLedger) unmarshal(result []byte, v interface{}) {
+	if err := json.Unmarshal(result, v); err != nil {
+		ledger.t.Fatalf("%s: %v", result, err)
+	}
+}
@@ -0,0 +1,403 @@
+// Telemetry from asset controllers
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// default for the time in seconds a reported state has to persist before it is applied to the asset. Can be changed
+// with setDebounceWindow.
+const defaultDebounceWindow = 60
+
+// A DeviceEvent is a status report of the controller of an asset, signed with the key registered for the asset.
+type DeviceEvent struct {
+	AssetID      string
+	Seq          int64 // sequence number of the event, increasing per device
+	Time         int64 // time the controller observed the state, in Unix seconds
+	IsWorking    bool
+	TechPart     string // TechPart, ErrorID and ErrorMessage describe the failure if IsWorking is false
+	ErrorID      string
+	ErrorMessage string
+	Signature    string // base64 encoded ASN.1 ECDSA signature of the SHA-256 hash of signedPayload
+}
+
+// DeviceTelemetry tracks the events received from the controller of an asset.
+type DeviceTelemetry struct {
+	AssetID      string
+	PublicKey    string       // PEM encoded ECDSA public key of the controller
+	LastSeq      int64        // highest Seq received, events up to it are duplicates
+	LastSeen     int64        // Time of the last event
+	LastReceived int64        // time of the transaction that ingested the last event
+	Pending      *DeviceEvent // state change reported by the controller that is not applied yet, see setDebounceWindow
+	PendingSince int64        // time of the transaction that ingested Pending, the debounce window starts then
+}
+
+// result of ingesting one event (IngestResult.Result)
+const (
+	ingestApplied   = "APPLIED"   // the event changed the state of the asset
+	ingestRecorded  = "RECORDED"  // the event confirmed the current state of the asset
+	ingestPending   = "PENDING"   // the event reported a state change that is applied once it persists for the debounce window
+	ingestDebounced = "DEBOUNCED" // the event reverted a pending state change within the debounce window, both were dropped
+	ingestDuplicate = "DUPLICATE" // an event with the same or a higher Seq was ingested before
+	ingestRejected  = "REJECTED"  // the event is invalid or its state change could not be applied, see Reason
+)
+
+// An IngestResult tells what became of an event passed to ingestTelemetry.
+type IngestResult struct {
+	AssetID  string
+	Seq      int64
+	Result   string
+	TicketID string // ticket opened or updated by the event
+	Reason   string // why the event was rejected
+}
+
+// Register the key the controller of an asset signs its events with. Arguments are the AssetID and the PEM encoded
+// ECDSA public key. A registered key can only be replaced by a caller whose certificate has the role OPERATOR (see
+// getCallerRole), the sequence numbers received so far are kept.
+func (t *SimpleChaincode) registerDeviceKey(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 2 {
+		return nil, errors.New("Wrong number of arguments, must be 2: AssetID and public key")
+	}
+	if _, err := getAsset(stub, args[0]); err != nil {
+		return nil, err
+	}
+	if _, err := parseDeviceKey(args[1]); err != nil {
+		return nil, err
+	}
+	telemetry, err := getDeviceTelemetry(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if telemetry.PublicKey != "" {
+		if role, err := getCallerRole(stub); err != nil || role != roleOperator {
+			return nil, errors.New("Asset " + args[0] + " already has a key, only the station operator can replace it")
+		}
+	}
+	telemetry.PublicKey = args[1]
+	return nil, putDeviceTelemetry(stub, telemetry)
+}
+
+// set the time in seconds a state reported by a controller has to persist before it is applied to the asset.
+func (t *SimpleChaincode) setDebounceWindow(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Wrong number of arguments, must be 1: debounce window in seconds")
+	}
+	window, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || window < 0 {
+		return nil, errors.New("Debounce window must be a non-negative number of seconds")
+	}
+	return nil, stub.PutState(configKey("debounceWindow"), []byte(strconv.FormatInt(window, 10)))
+}
+
+// Ingest a batch of controller events. Input is a JSON array of DeviceEvents. The events of each device are processed
+// in Seq order; an event that is duplicate, not signed with the key of its device or for a decommissioned asset is
+// skipped. A reported state change is applied like setAssetState once it was reported for the debounce window, or
+// dropped if the device reports the previous state again before. The window is measured in transaction time, the
+// clocks of the controllers are not trusted for it. Pending changes of all devices whose window has passed are applied
+// as well. Returns the IngestResult of every event as JSON array.
+func (t *SimpleChaincode) ingestTelemetry(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Wrong number of arguments, must be 1: events as JSON array")
+	}
+	var events []DeviceEvent
+	if err := json.Unmarshal([]byte(args[0]), &events); err != nil {
+		return nil, errors.New("Events are no valid JSON array: " + err.Error())
+	}
+	sort.Stable(byDeviceSeq(events))
+	window := getDebounceWindowSeconds(stub)
+
+	results := []IngestResult{}
+	for i := range events {
+		result, err := t.ingestEvent(stub, &events[i], window)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, *result)
+	}
+
+	// state changes the devices did not report again are applied once their window has passed. A range scan does not
+	// return what the events above wrote, so every device it finds is read again; a change applied for an event of the
+	// batch must not open a second ticket.
+	var assetIDs []string
+	err := forEachInRange(stub, telemetryKey(""), telemetryKey("~"), func(telemetryAsByteArr []byte) error {
+		var telemetry DeviceTelemetry
+		if err := json.Unmarshal(telemetryAsByteArr, &telemetry); err != nil {
+			return err
+		}
+		if telemetry.Pending != nil {
+			assetIDs = append(assetIDs, telemetry.AssetID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	now := getTransactionTime(stub)
+	for _, assetID := range assetIDs {
+		telemetry, err := getDeviceTelemetry(stub, assetID)
+		if err != nil {
+			return nil, err
+		}
+		if telemetry.Pending == nil || now-telemetry.PendingSince < window {
+			continue
+		}
+		result, err := t.applyPending(stub, telemetry)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, *result)
+	}
+	return json.Marshal(results)
+}
+
+// returns the telemetry records of all devices with a registered key, ordered by AssetID. Input is optionally a number
+// of seconds to return only the devices that sent no event for longer than that at the time of the transaction.
+func (t *SimpleChaincode) getDeviceTelemetry(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) > 1 {
+		return nil, errors.New("Wrong number of arguments, must be 0 or 1: optionally the seconds since the last event")
+	}
+	var silentFor int64 = -1
+	if len(args) == 1 {
+		var err error
+		if silentFor, err = strconv.ParseInt(args[0], 10, 64); err != nil || silentFor < 0 {
+			return nil, errors.New("Seconds since the last event must be a non-negative number")
+		}
+	}
+	now := getTransactionTime(stub)
+	result := []DeviceTelemetry{}
+	err := forEachInRange(stub, telemetryKey(""), telemetryKey("~"), func(telemetryAsByteArr []byte) error {
+		var telemetry DeviceTelemetry
+		if err := json.Unmarshal(telemetryAsByteArr, &telemetry); err != nil {
+			return err
+		}
+		if silentFor < 0 || now-telemetry.LastSeen > silentFor {
+			result = append(result, telemetry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(result)
+}
+
+func (t *SimpleChaincode) getDebounceWindow(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	return []byte(strconv.FormatInt(getDebounceWindowSeconds(stub), 10)), nil
+}
+
+// ingestEvent validates a single event and updates the telemetry of its device. Only failures writing the world state
+// are returned as error, invalid events are reported in the result.
+func (t *SimpleChaincode) ingestEvent(stub shim.ChaincodeStubInterface, event *DeviceEvent, window int64) (*IngestResult, error) {
+	result := &IngestResult{AssetID: event.AssetID, Seq: event.Seq}
+	telemetry, err := getDeviceTelemetry(stub, event.AssetID)
+	if err != nil {
+		return nil, err
+	}
+	if reason := telemetry.check(stub, event); reason != "" {
+		result.Result, result.Reason = ingestRejected, reason
+		return result, nil
+	}
+	if event.Seq <= telemetry.LastSeq {
+		result.Result = ingestDuplicate
+		return result, nil
+	}
+	asset, err := getAsset(stub, event.AssetID)
+	if err != nil {
+		return nil, err
+	}
+	now := getTransactionTime(stub)
+	telemetry.LastSeq = event.Seq
+	telemetry.LastSeen = event.Time
+	telemetry.LastReceived = now
+
+	switch {
+	case event.IsWorking == asset.IsWorking && telemetry.Pending != nil:
+		telemetry.Pending, telemetry.PendingSince = nil, 0
+		result.Result = ingestDebounced
+	case event.IsWorking == asset.IsWorking:
+		result.Result = ingestRecorded
+	default:
+		if telemetry.Pending == nil || telemetry.Pending.IsWorking != event.IsWorking {
+			telemetry.Pending, telemetry.PendingSince = event, now
+		}
+		if now-telemetry.PendingSince < window {
+			result.Result = ingestPending
+			break
+		}
+		applied, err := t.applyPending(stub, telemetry)
+		if err != nil {
+			return nil, err
+		}
+		result.Result, result.TicketID, result.Reason = applied.Result, applied.TicketID, applied.Reason
+		return result, nil
+	}
+	return result, putDeviceTelemetry(stub, telemetry)
+}
+
+// applyPending applies the pending state change of the device to its asset like setAssetState and clears it. A change
+// setAssetState refuses, e.g. because the station of the asset is not registered, is dropped and reported as REJECTED.
+func (t *SimpleChaincode) applyPending(stub shim.ChaincodeStubInterface, telemetry *DeviceTelemetry) (*IngestResult, error) {
+	event := telemetry.Pending
+	telemetry.Pending, telemetry.PendingSince = nil, 0
+	if err := putDeviceTelemetry(stub, telemetry); err != nil {
+		return nil, err
+	}
+
+	result := &IngestResult{AssetID: event.AssetID, Seq: event.Seq, Result: ingestApplied}
+	asset, err := getAsset(stub, event.AssetID)
+	if err != nil {
+		return nil, err
+	}
+	if asset.isDecommissioned() || asset.IsWorking == event.IsWorking {
+		// changed by other means in the meantime
+		result.Result = ingestRecorded
+		return result, nil
+	}
+	var ticketID []byte
+	if event.IsWorking {
+		reason := "reported working by the controller, event " + strconv.FormatInt(event.Seq, 10)
+		ticketID, err = t.setAssetState(stub, []string{event.AssetID, "true", reason})
+	} else {
+		ticketID, err = t.setAssetState(stub, []string{event.AssetID, "false", event.TechPart, event.ErrorID, event.ErrorMessage})
+	}
+	if err != nil {
+		result.Result, result.Reason = ingestRejected, err.Error()
+		return result, nil
+	}
+	result.TicketID = string(ticketID)
+	return result, nil
+}
+
+// check returns why the event cannot be ingested for the device, or "" if it can.
+func (telemetry *DeviceTelemetry) check(stub shim.ChaincodeStubInterface, event *DeviceEvent) string {
+	if telemetry.PublicKey == "" {
+		return "no key registered for asset " + event.AssetID + ", see registerDeviceKey"
+	}
+	if !event.verify(telemetry.PublicKey) {
+		return "invalid signature"
+	}
+	asset, err := getAsset(stub, event.AssetID)
+	if err != nil {
+		return err.Error()
+	}
+	if asset.isDecommissioned() {
+		return "asset " + event.AssetID + " is decommissioned"
+	}
+	if !event.IsWorking {
+		if err = checkErrorID(stub, asset, event.ErrorID); err != nil {
+			return err.Error()
+		}
+	}
+	return ""
+}
+
+// signedPayload is the content of the event covered by its signature, the fields joined by "|".
+func (event *DeviceEvent) signedPayload() []byte {
+	return []byte(strings.Join([]string{
+		event.AssetID,
+		strconv.FormatInt(event.Seq, 10),
+		strconv.FormatInt(event.Time, 10),
+		strconv.FormatBool(event.IsWorking),
+		event.TechPart,
+		event.ErrorID,
+		event.ErrorMessage,
+	}, "|"))
+}
+
+// verify checks the signature of the event against the PEM encoded public key.
+func (event *DeviceEvent) verify(publicKey string) bool {
+	key, err := parseDeviceKey(publicKey)
+	if err != nil {
+		return false
+	}
+	signature, err := base64.StdEncoding.DecodeString(event.Signature)
+	if err != nil {
+		return false
+	}
+	var rs struct {
+		R, S *big.Int
+	}
+	if rest, err := asn1.Unmarshal(signature, &rs); err != nil || len(rest) > 0 {
+		return false
+	}
+	hash := sha256.Sum256(event.signedPayload())
+	return ecdsa.Verify(key, hash[:], rs.R, rs.S)
+}
+
+func parseDeviceKey(publicKey string) (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(publicKey))
+	if block == nil {
+		return nil, errors.New("Public key is not PEM encoded")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.New("Public key is invalid: " + err.Error())
+	}
+	ecdsaKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("Public key is no ECDSA key")
+	}
+	return ecdsaKey, nil
+}
+
+// byDeviceSeq sorts events by AssetID, then by Seq.
+type byDeviceSeq []DeviceEvent
+
+func (s byDeviceSeq) Len() int      { return len(s) }
+func (s byDeviceSeq) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byDeviceSeq) Less(i, j int) bool {
+	if s[i].AssetID != s[j].AssetID {
+		return s[i].AssetID < s[j].AssetID
+	}
+	return s[i].Seq < s[j].Seq
+}
+
+func getDebounceWindowSeconds(stub shim.ChaincodeStubInterface) int64 {
+	windowAsBytes, err := stub.GetState(configKey("debounceWindow"))
+	if err != nil || windowAsBytes == nil {
+		return defaultDebounceWindow
+	}
+	window, err := strconv.ParseInt(string(windowAsBytes), 10, 64)
+	if err != nil {
+		return defaultDebounceWindow
+	}
+	return window
+}
+
+// getDeviceTelemetry reads the telemetry of the device, a new record if the device has none yet.
+func getDeviceTelemetry(stub shim.ChaincodeStubInterface, assetID string) (*DeviceTelemetry, error) {
+	telemetryAsByteArr, err := stub.GetState(telemetryKey(assetID))
+	if err != nil {
+		return nil, err
+	}
+	telemetry := &DeviceTelemetry{AssetID: assetID}
+	if telemetryAsByteArr == nil {
+		return telemetry, nil
+	}
+	return telemetry, json.Unmarshal(telemetryAsByteArr, telemetry)
+}
+
+func putDeviceTelemetry(stub shim.ChaincodeStubInterface, telemetry *DeviceTelemetry) error {
+	telemetryAsByteArr, err := json.Marshal(telemetry)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(telemetryKey(telemetry.AssetID), telemetryAsByteArr)
+}
+
+func telemetryKey(assetID string) string {
+	return "telemetry/" + assetID
+}
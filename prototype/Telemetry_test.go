@@ -0,0 +1,341 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"reflect"
+	"testing"
+)
+
+// newDeviceKey returns the private key of a controller and its public key as registered with registerDeviceKey.
+func newDeviceKey(t *testing.T) (*ecdsa.PrivateKey, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+// sign sets the signature of the event the way a controller does, see DeviceEvent.Signature.
+func sign(key *ecdsa.PrivateKey, event DeviceEvent) DeviceEvent {
+	hash := sha256.Sum256(event.signedPayload())
+	r, s, _ := ecdsa.Sign(rand.Reader, key, hash[:])
+	der, _ := asn1.Marshal(struct{ R, S interface{} }{r, s})
+	event.Signature = base64.StdEncoding.EncodeToString(der)
+	return event
+}
+
+func TestDeviceEventVerify(t *testing.T) {
+	key, publicKey := newDeviceKey(t)
+	_, otherKey := newDeviceKey(t)
+	event := sign(key, DeviceEvent{AssetID: "DO0001", Seq: 1, Time: 1000, ErrorID: "#2356-102", ErrorMessage: "Totalausfall"})
+	signature, _ := base64.StdEncoding.DecodeString(event.Signature)
+
+	tests := []struct {
+		name      string
+		change    func(event *DeviceEvent)
+		publicKey string
+		valid     bool
+	}{
+		{"signed event", func(event *DeviceEvent) {}, publicKey, true},
+		{"other key", func(event *DeviceEvent) {}, otherKey, false},
+		{"key not PEM encoded", func(event *DeviceEvent) {}, "garbage", false},
+		{"changed state", func(event *DeviceEvent) { event.IsWorking = true }, publicKey, false},
+		{"changed Seq", func(event *DeviceEvent) { event.Seq = 2 }, publicKey, false},
+		{"changed ErrorMessage", func(event *DeviceEvent) { event.ErrorMessage = "Stufe fehlt" }, publicKey, false},
+		{"no signature", func(event *DeviceEvent) { event.Signature = "" }, publicKey, false},
+		{"signature not base64", func(event *DeviceEvent) { event.Signature = "!" + event.Signature }, publicKey, false},
+		{"trailing bytes", func(event *DeviceEvent) {
+			event.Signature = base64.StdEncoding.EncodeToString(append(signature, 0))
+		}, publicKey, false},
+	}
+	for _, test := range tests {
+		changed := event
+		test.change(&changed)
+		if valid := changed.verify(test.publicKey); valid != test.valid {
+			t.Errorf("%s: verify returned %t", test.name, valid)
+		}
+	}
+}
+
+// ingest calls ingestTelemetry with the events in a transaction of its own and returns the results.
+func (ledger *testLedger) ingest(events ...DeviceEvent) []IngestResult {
+	eventsAsJSON, err := json.Marshal(events)
+	if err != nil {
+		ledger.t.Fatal(err)
+	}
+	result, err := ledger.cc.Invoke(ledger.stub, "ingestTelemetry", []string{string(eventsAsJSON)})
+	if err != nil {
+		ledger.t.Fatalf("ingestTelemetry: %v", err)
+	}
+	ledger.stub.commit()
+	var results []IngestResult
+	ledger.unmarshal(result, &results)
+	return results
+}
+
+// deviceEvent returns a signed event reporting the asset working, or failed with a code of the error catalogue.
+func deviceEvent(key *ecdsa.PrivateKey, assetID string, seq int64, time int64, isWorking bool) DeviceEvent {
+	event := DeviceEvent{AssetID: assetID, Seq: seq, Time: time, IsWorking: isWorking}
+	if !isWorking {
+		event.TechPart, event.ErrorID, event.ErrorMessage = "Motor", "#2356-102", "Totalausfall"
+	}
+	return sign(key, event)
+}
+
+func TestRegisterDeviceKey(t *testing.T) {
+	_, publicKey := newDeviceKey(t)
+	_, otherKey := newDeviceKey(t)
+	tests := []struct {
+		name   string
+		caller string // caller replacing the key registered for DO0001, see commentCallers
+		args   []string
+		valid  bool
+	}{
+		{"first key", "", []string{"BR0002", publicKey}, true},
+		{"unknown asset", "", []string{"XX0099", publicKey}, false},
+		{"key not PEM encoded", "", []string{"BR0002", "garbage"}, false},
+		{"replaced by the operator", "betrieb", []string{"DO0001", otherKey}, true},
+		{"replaced by a mechanic", "hans", []string{"DO0001", otherKey}, false},
+		{"replaced without role", "anonym", []string{"DO0001", otherKey}, false},
+		{"missing key", "", []string{"BR0002"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ledger := newTestLedger(t, 1000)
+			ledger.mustInvoke("registerDeviceKey", "DO0001", publicKey)
+			ledger.callAs(test.caller)
+			if err := ledger.invoke("registerDeviceKey", test.args...); (err == nil) != test.valid {
+				t.Fatalf("registerDeviceKey%q: err = %v", test.args, err)
+			}
+			telemetry, err := getDeviceTelemetry(ledger.stub, test.args[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.valid && telemetry.PublicKey != test.args[1] {
+				t.Errorf("telemetry of %s = %+v", test.args[0], telemetry)
+			}
+		})
+	}
+}
+
+func TestIngestTelemetryDebouncing(t *testing.T) {
+	// every report is a transaction of its own. The clock of the controller is stuck, the window is measured with the
+	// transaction times.
+	type report struct {
+		txTime    int64
+		seq       int64
+		isWorking bool
+		result    string
+	}
+	tests := []struct {
+		name      string
+		window    string
+		reports   []report
+		isWorking bool // state of DO0001 after the reports
+	}{
+		{"confirmation of the current state", "60", []report{
+			{1000, 1, true, ingestRecorded},
+		}, true},
+		{"failure persisting for the window", "60", []report{
+			{1000, 1, false, ingestPending},
+			{1030, 2, false, ingestPending},
+			{1060, 3, false, ingestApplied},
+		}, false},
+		{"failure reverted within the window", "60", []report{
+			{1000, 1, false, ingestPending},
+			{1030, 2, true, ingestDebounced},
+			{1070, 3, false, ingestPending},
+		}, true},
+		{"failure and recovery each persisting for the window", "60", []report{
+			{1000, 1, false, ingestPending},
+			{1100, 2, false, ingestApplied},
+			{1200, 3, true, ingestPending},
+			{1300, 4, true, ingestApplied},
+		}, true},
+		{"repeated and older events", "60", []report{
+			{1000, 2, false, ingestPending},
+			{1010, 2, false, ingestDuplicate},
+			{1020, 1, true, ingestDuplicate},
+			{1060, 3, false, ingestApplied},
+		}, false},
+		{"no debouncing", "0", []report{
+			{1000, 1, false, ingestApplied},
+		}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ledger := newTestLedger(t, 1000)
+			key, publicKey := newDeviceKey(t)
+			ledger.mustInvoke("registerDeviceKey", "DO0001", publicKey)
+			ledger.mustInvoke("setDebounceWindow", test.window)
+			for i, report := range test.reports {
+				ledger.stub.time = report.txTime
+				results := ledger.ingest(deviceEvent(key, "DO0001", report.seq, 5000, report.isWorking))
+				if len(results) != 1 || results[0].Result != report.result {
+					t.Errorf("report %d: got %+v, want %s", i+1, results, report.result)
+				}
+			}
+			if ledger.escalatorWorking("DO0001") != test.isWorking {
+				t.Errorf("DO0001 working = %t, want %t", !test.isWorking, test.isWorking)
+			}
+		})
+	}
+}
+
+func TestIngestTelemetryBatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		window  string
+		txTime  int64 // time of the second transaction, the first one is at 1000
+		first   []DeviceEvent
+		second  []DeviceEvent
+		results []string // Result of every IngestResult of the second transaction
+		tickets int      // tickets opened by both transactions
+	}{
+		{"failure reported twice in a batch", "0", 1000, nil, []DeviceEvent{
+			{AssetID: "DO0001", Seq: 1}, {AssetID: "DO0001", Seq: 2},
+		}, []string{ingestApplied, ingestRecorded}, 1},
+		{"failure, recovery and failure in a batch", "0", 1000, nil, []DeviceEvent{
+			{AssetID: "DO0001", Seq: 1}, {AssetID: "DO0001", Seq: 2, IsWorking: true}, {AssetID: "DO0001", Seq: 3},
+		}, []string{ingestApplied, ingestApplied, ingestApplied}, 1},
+		{"pending failure confirmed after the window", "60", 1060, []DeviceEvent{
+			{AssetID: "DO0001", Seq: 1},
+		}, []DeviceEvent{
+			{AssetID: "DO0001", Seq: 2},
+		}, []string{ingestApplied}, 1},
+		{"pending failures applied by the sweep", "60", 1060, []DeviceEvent{
+			{AssetID: "BR0002", Seq: 1}, {AssetID: "DO0001", Seq: 1},
+		}, []DeviceEvent{
+			{AssetID: "DO0001", Seq: 1},
+		}, []string{ingestDuplicate, ingestApplied, ingestApplied}, 2},
+		{"window not passed", "60", 1059, []DeviceEvent{
+			{AssetID: "BR0002", Seq: 1},
+		}, []DeviceEvent{
+			{AssetID: "DO0001", Seq: 1, IsWorking: true},
+		}, []string{ingestRecorded}, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ledger := newTestLedger(t, 1000)
+			key, publicKey := newDeviceKey(t)
+			ledger.mustInvoke("registerDeviceKey", "DO0001", publicKey)
+			ledger.mustInvoke("registerDeviceKey", "BR0002", publicKey)
+			ledger.mustInvoke("setDebounceWindow", test.window)
+			signAll := func(events []DeviceEvent) []DeviceEvent {
+				signed := []DeviceEvent{}
+				for _, event := range events {
+					signed = append(signed, deviceEvent(key, event.AssetID, event.Seq, 1000, event.IsWorking))
+				}
+				return signed
+			}
+			if test.first != nil {
+				ledger.ingest(signAll(test.first)...)
+			}
+			ledger.stub.time = test.txTime
+			results := ledger.ingest(signAll(test.second)...)
+			got := []string{}
+			for _, result := range results {
+				got = append(got, result.Result)
+			}
+			if !reflect.DeepEqual(got, test.results) {
+				t.Errorf("results = %+v, want %q", results, test.results)
+			}
+			tickets, err := getTickets(ledger.stub)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tickets) != test.tickets {
+				t.Errorf("%d tickets were opened, want %d: %+v", len(tickets), test.tickets, tickets)
+			}
+		})
+	}
+}
+
+func TestIngestTelemetryRejected(t *testing.T) {
+	key, publicKey := newDeviceKey(t)
+	otherKey, _ := newDeviceKey(t)
+	tests := []struct {
+		name  string
+		event DeviceEvent
+	}{
+		{"no key registered", deviceEvent(key, "BR0002", 1, 1000, true)},
+		{"signed with another key", deviceEvent(otherKey, "DO0001", 1, 1000, true)},
+		{"changed after signing", func() DeviceEvent {
+			event := deviceEvent(key, "DO0001", 1, 1000, true)
+			event.IsWorking = false
+			return event
+		}()},
+		{"unknown ErrorID", deviceEvent(key, "DO0003", 1, 1000, false)}, // not in the catalogue of elevators
+		{"decommissioned asset", deviceEvent(key, "DO0004", 1, 1000, false)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ledger := newTestLedger(t, 1000)
+			ledger.mustInvoke("createAsset", "ELEVATOR", "DO", "4", `{"Attributes":{"LoadCapacity":"1000"}}`)
+			ledger.mustInvoke("createEscalator", "DO", "4")
+			for _, assetID := range []string{"DO0001", "DO0003", "DO0004"} {
+				ledger.mustInvoke("registerDeviceKey", assetID, publicKey)
+			}
+			ledger.mustInvoke("decommissionEscalator", "DO0004", "Abriss des Bahnsteigs")
+			ledger.mustInvoke("setDebounceWindow", "0")
+			results := ledger.ingest(test.event)
+			if len(results) != 1 || results[0].Result != ingestRejected || results[0].Reason == "" {
+				t.Errorf("results = %+v", results)
+			}
+			if telemetry, _ := getDeviceTelemetry(ledger.stub, test.event.AssetID); telemetry.LastSeq != 0 {
+				t.Errorf("the rejected event was counted: %+v", telemetry)
+			}
+			if tickets, _ := getTickets(ledger.stub); len(tickets) != 0 {
+				t.Errorf("the rejected event opened a ticket: %+v", tickets)
+			}
+		})
+	}
+}
+
+func TestGetDeviceTelemetry(t *testing.T) {
+	ledger := newTestLedger(t, 1000)
+	key, publicKey := newDeviceKey(t)
+	ledger.mustInvoke("registerDeviceKey", "DO0001", publicKey)
+	ledger.mustInvoke("registerDeviceKey", "BR0002", publicKey)
+	ledger.ingest(deviceEvent(key, "DO0001", 1, 1000, true), deviceEvent(key, "BR0002", 1, 400, true))
+	ledger.stub.time = 1500
+
+	tests := []struct {
+		args []string
+		want []string // AssetIDs
+	}{
+		{nil, []string{"BR0002", "DO0001"}},
+		{[]string{"600"}, []string{"BR0002"}},
+		{[]string{"1200"}, []string{}},
+	}
+	for _, test := range tests {
+		result, err := ledger.query("getDeviceTelemetry", test.args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var telemetry []DeviceTelemetry
+		ledger.unmarshal(result, &telemetry)
+		got := []string{}
+		for _, device := range telemetry {
+			got = append(got, device.AssetID)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("getDeviceTelemetry%q = %q, want %q", test.args, got, test.want)
+		}
+	}
+	if _, err := ledger.query("getDeviceTelemetry", "-1"); err == nil {
+		t.Error("getDeviceTelemetry accepted -1 seconds")
+	}
+}
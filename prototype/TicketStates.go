@@ -0,0 +1,248 @@
+// Ticket state machine
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Ticket status values (Ticket.Status)
+const (
+	statusNew       = "EINGETROFFEN" // ticket was created, no service provider yet
+	statusAssigned  = "ZUGEWIESEN"   // ticket is assigned to a service provider
+	statusDone      = "ERLEDIGT"     // repairs are finished, ticket is closed
+	statusCancelled = "STORNIERT"    // ticket was cancelled, e.g. as false alarm. Never counted in any SLA
+)
+
+// Repair status values (Ticket.RepairStatus)
+const (
+	repairChecking         = "Wird geprueft"
+	repairMechanicAssigned = "Ticket erhalten"
+	repairOnTheWay         = "Techniker in Anfahrt"
+	repairOnSite           = "Techniker vor Ort"
+	repairStarted          = "Reparatur begonnen"
+	repairReporting        = "Im Abschluss"
+	repairAwaitingAccept   = "Wartet auf Abnahme" // provider finished, station operator has to accept the repair
+	repairFinished         = "Reparatur abgeschlossen"
+)
+
+// A TicketState is the combination of Status and RepairStatus a ticket is in.
+type TicketState struct {
+	Status       string
+	RepairStatus string
+}
+
+func (s TicketState) String() string {
+	if s.RepairStatus == "" {
+		return s.Status
+	}
+	return s.Status + "/" + s.RepairStatus
+}
+
+// the states a ticket passes through during its life cycle
+var (
+	stateNew              = TicketState{statusNew, ""}
+	stateAssigned         = TicketState{statusAssigned, repairChecking}
+	stateMechanicAssigned = TicketState{statusAssigned, repairMechanicAssigned}
+	stateOnTheWay         = TicketState{statusAssigned, repairOnTheWay}
+	stateOnSite           = TicketState{statusAssigned, repairOnSite}
+	stateRepairing        = TicketState{statusAssigned, repairStarted}
+	stateReporting        = TicketState{statusAssigned, repairReporting}
+	stateAwaitingAccept   = TicketState{statusAssigned, repairAwaitingAccept}
+	stateDone             = TicketState{statusDone, repairFinished}
+	stateCancelled        = TicketState{statusCancelled, ""}
+)
+
+// all open states in which a service provider is working on the ticket
+var assignedStates = []TicketState{stateAssigned, stateMechanicAssigned, stateOnTheWay, stateOnSite, stateRepairing, stateReporting}
+
+// all states before the service provider finished the repair
+var unfinishedStates = append([]TicketState{stateNew}, assignedStates...)
+
+// all states in which a ticket is still open
+var openStates = append(append([]TicketState{}, unfinishedStates...), stateAwaitingAccept)
+
+// all states a ticket can be in
+var allStates = append(append([]TicketState{}, openStates...), stateDone, stateCancelled)
+
+// actions of ticketTransitions that cannot be called on a single ticket
+var internalActions = map[string]bool{
+	"generateMaintenanceTickets": true, // creates planned tickets already assigned to their provider
+}
+
+// stateUnchanged as target of a transition keeps the ticket in its current state
+var stateUnchanged = TicketState{}
+
+// A PauseRule tells whether a transition may be taken while the SLA clock of a ticket is paused.
+type PauseRule int
+
+const (
+	notPaused  PauseRule = iota // only while the SLA clock is running
+	onlyPaused                  // only while the SLA clock is paused
+	anyPause                    // regardless of the SLA clock
+)
+
+// A TicketTransition allows Action to be called on a ticket in one of the From states and moves the ticket to To.
+type TicketTransition struct {
+	Action string
+	From   []TicketState
+	To     TicketState
+	Paused PauseRule
+}
+
+// ticketTransitions is the transition table of the ticket state machine. Every invoke that changes a ticket has to
+// be listed here, calling it on a ticket in any other state is rejected. Actions in internalActions are taken by the
+// chaincode itself and are never offered by getAllowedActions.
+var ticketTransitions = []TicketTransition{
+	{"assignTicket", []TicketState{stateNew}, stateAssigned, notPaused},
+	{"generateMaintenanceTickets", []TicketState{stateNew}, stateAssigned, notPaused},
+	{"reassignTicket", assignedStates, stateAssigned, notPaused},
+	{"assignMechanic", []TicketState{stateAssigned, stateMechanicAssigned}, stateMechanicAssigned, notPaused},
+	{"startJourney", []TicketState{stateMechanicAssigned}, stateOnTheWay, notPaused},
+	{"onArrival", []TicketState{stateOnTheWay}, stateOnSite, notPaused},
+	{"startRepair", []TicketState{stateOnSite}, stateRepairing, notPaused},
+	{"writeFinalReport", []TicketState{stateRepairing, stateReporting}, stateReporting, notPaused},
+	{"finishRepair", []TicketState{stateReporting}, stateAwaitingAccept, notPaused},
+	{"acceptRepair", []TicketState{stateAwaitingAccept}, stateDone, notPaused},
+	{"rejectRepair", []TicketState{stateAwaitingAccept}, stateRepairing, notPaused},
+	{"cancelTicket", unfinishedStates, stateCancelled, anyPause},
+	{"pauseTicket", assignedStates, stateUnchanged, notPaused},
+	{"resumeTicket", assignedStates, stateUnchanged, onlyPaused},
+	{"decidePause", openStates, stateUnchanged, anyPause},
+	{"reviseEta", []TicketState{stateOnSite, stateRepairing, stateReporting}, stateUnchanged, anyPause},
+	{"addComment", allStates, stateUnchanged, anyPause},
+}
+
+// currentState returns the TicketState the ticket is in. Status values are compared case insensitive, as older
+// tickets may carry e.g. "Eingetroffen" instead of "EINGETROFFEN".
+func (ticket *Ticket) currentState() TicketState {
+	for _, transition := range ticketTransitions {
+		for _, from := range transition.From {
+			if from.matches(ticket) {
+				return from
+			}
+		}
+		if transition.To != stateUnchanged && transition.To.matches(ticket) {
+			return transition.To
+		}
+	}
+	return TicketState{ticket.Status, ticket.RepairStatus}
+}
+
+func (s TicketState) matches(ticket *Ticket) bool {
+	return strings.EqualFold(s.Status, ticket.Status) && strings.EqualFold(s.RepairStatus, ticket.RepairStatus)
+}
+
+// findTransition returns the transition that allows action on a ticket in state current, if there is one.
+func findTransition(current TicketState, action string) (TicketTransition, bool) {
+	for _, transition := range ticketTransitions {
+		if transition.Action == action && transition.allowedFrom(current) {
+			return transition, true
+		}
+	}
+	return TicketTransition{}, false
+}
+
+func (transition TicketTransition) allowedFrom(current TicketState) bool {
+	for _, from := range transition.From {
+		if from == current {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedWhile reports whether the transition may be taken with the SLA clock of the ticket paused or running.
+func (transition TicketTransition) allowedWhile(paused bool) bool {
+	switch transition.Paused {
+	case onlyPaused:
+		return paused
+	case anyPause:
+		return true
+	default:
+		return !paused
+	}
+}
+
+// transition moves the ticket to the state that follows action or returns an error naming the current and the
+// attempted state if action is not allowed in the ticket's current state.
+func (ticket *Ticket) transition(action string) error {
+	current := ticket.currentState()
+	transition, ok := findTransition(current, action)
+	if !ok {
+		attempted := "unknown"
+		for _, candidate := range ticketTransitions {
+			if candidate.Action == action {
+				attempted = candidate.To.String()
+				if candidate.To == stateUnchanged {
+					attempted = current.String()
+				}
+				break
+			}
+		}
+		return fmt.Errorf("Illegal transition for ticket %s: %s (-> %s) is not allowed in state %s",
+			ticket.TicketID, action, attempted, current)
+	}
+	if paused := ticket.isPaused(); !transition.allowedWhile(paused) {
+		if paused {
+			return fmt.Errorf("Illegal transition for ticket %s: %s is not allowed while the ticket is paused, resume it first",
+				ticket.TicketID, action)
+		}
+		return fmt.Errorf("Illegal transition for ticket %s: %s is only allowed while the ticket is paused",
+			ticket.TicketID, action)
+	}
+	if transition.To != stateUnchanged {
+		ticket.Status = transition.To.Status
+		ticket.RepairStatus = transition.To.RepairStatus
+	}
+	return nil
+}
+
+// isOpen reports whether the ticket is neither finished nor cancelled.
+func (ticket *Ticket) isOpen() bool {
+	current := ticket.currentState()
+	for _, state := range openStates {
+		if state == current {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedActions returns the names of all actions that may be called on the ticket in its current state.
+func (ticket *Ticket) allowedActions() []string {
+	current := ticket.currentState()
+	paused := ticket.isPaused()
+	actions := []string{}
+	for _, transition := range ticketTransitions {
+		if transition.allowedFrom(current) && transition.allowedWhile(paused) && !internalActions[transition.Action] {
+			actions = append(actions, transition.Action)
+		}
+	}
+	return actions
+}
+
+// returns the current state of a ticket and the actions that may be called next. Input is the TicketID.
+func (t *SimpleChaincode) getAllowedActions(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Wrong number of arguments, must be 1: TicketID")
+	}
+
+	ticket, err := getTicket(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	var result = struct {
+		TicketID       string
+		State          string
+		Paused         bool
+		AllowedActions []string
+	}{ticket.TicketID, ticket.currentState().String(), ticket.isPaused(), ticket.allowedActions()}
+
+	return json.Marshal(result)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// repairReportJSON is the final report written in ticketWorkflow.
+const repairReportJSON = `{"RootCause":"WEAR","Labour":[{"Mechanic":"Hans","Hours":2}],"Text":"Stufe getauscht"}`
+
+// ticketWorkflow lists the states a ticket passes through, the actions allowed in each of them and the action taking
+// it to the next state, with the arguments following the TicketID.
+var ticketWorkflow = []struct {
+	state   TicketState
+	allowed []string
+	action  string
+	args    []string
+}{
+	{stateNew, []string{"assignTicket", "cancelTicket", "decidePause", "addComment"}, "assignTicket",
+		[]string{"Thyssen"}},
+	{stateAssigned, []string{"reassignTicket", "assignMechanic", "cancelTicket", "pauseTicket", "decidePause",
+		"addComment"}, "assignMechanic", []string{"Hans"}},
+	{stateMechanicAssigned, []string{"reassignTicket", "assignMechanic", "startJourney", "cancelTicket", "pauseTicket",
+		"decidePause", "addComment"}, "startJourney", nil},
+	{stateOnTheWay, []string{"reassignTicket", "onArrival", "cancelTicket", "pauseTicket", "decidePause",
+		"addComment"}, "onArrival", []string{"Stufe gebrochen", "2h"}},
+	{stateOnSite, []string{"reassignTicket", "startRepair", "cancelTicket", "pauseTicket", "decidePause", "reviseEta",
+		"addComment"}, "startRepair", nil},
+	{stateRepairing, []string{"reassignTicket", "writeFinalReport", "cancelTicket", "pauseTicket", "decidePause",
+		"reviseEta", "addComment"}, "writeFinalReport", []string{repairReportJSON}},
+	{stateReporting, []string{"reassignTicket", "writeFinalReport", "finishRepair", "cancelTicket", "pauseTicket",
+		"decidePause", "reviseEta", "addComment"}, "finishRepair", nil},
+	{stateAwaitingAccept, []string{"acceptRepair", "rejectRepair", "decidePause", "addComment"}, "acceptRepair",
+		nil},
+	{stateDone, []string{"addComment"}, "", nil},
+}
+
+// advanceTicket moves the ticket along ticketWorkflow from its current state until it is in state target.
+func (ledger *testLedger) advanceTicket(ticketID string, target TicketState) {
+	for _, step := range ticketWorkflow {
+		state := ledger.ticket(ticketID).currentState()
+		if state == target {
+			return
+		}
+		if step.state == state && step.action != "" {
+			ledger.mustInvoke(step.action, append([]string{ticketID}, step.args...)...)
+		}
+	}
+	if state := ledger.ticket(ticketID).currentState(); state != target {
+		ledger.t.Fatalf("ticket %s is in state %s, not %s", ticketID, state, target)
+	}
+}
+
+func TestTicketWorkflow(t *testing.T) {
+	ledger := newTestLedger(t, 1000)
+	ledger.mustInvoke("createDefaultTicket")
+
+	for _, step := range ticketWorkflow {
+		if state := ledger.ticket("0001").currentState(); state != step.state {
+			t.Fatalf("state = %s, want %s", state, step.state)
+		}
+
+		result, err := ledger.query("getAllowedActions", "0001")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var actions struct {
+			State          string
+			AllowedActions []string
+		}
+		ledger.unmarshal(result, &actions)
+		if actions.State != step.state.String() || !reflect.DeepEqual(actions.AllowedActions, step.allowed) {
+			t.Errorf("getAllowedActions in %s = %s %q, want %q", step.state, actions.State, actions.AllowedActions,
+				step.allowed)
+		}
+
+		// every workflow action that is not allowed is rejected and leaves the ticket unchanged
+		for _, other := range ticketWorkflow {
+			if other.action == "" || contains(step.allowed, other.action) {
+				continue
+			}
+			err := ledger.invoke(other.action, append([]string{"0001"}, other.args...)...)
+			if err == nil || !strings.Contains(err.Error(), "Illegal transition") {
+				t.Errorf("%s in %s: err = %v, want illegal transition", other.action, step.state, err)
+			}
+			if state := ledger.ticket("0001").currentState(); state != step.state {
+				t.Fatalf("%s in %s moved the ticket to %s", other.action, step.state, state)
+			}
+		}
+
+		if step.action != "" {
+			ledger.mustInvoke(step.action, append([]string{"0001"}, step.args...)...)
+		}
+	}
+}
+
+func TestCurrentStateIgnoresCase(t *testing.T) {
+	tests := []struct {
+		status, repairStatus string
+		want                 TicketState
+	}{
+		{"Eingetroffen", "", stateNew},
+		{"zugewiesen", "techniker in anfahrt", stateOnTheWay},
+		{"ERLEDIGT", "Reparatur abgeschlossen", stateDone},
+		{"OPEN", "", TicketState{"OPEN", ""}},
+	}
+	for _, test := range tests {
+		ticket := &Ticket{Status: test.status, RepairStatus: test.repairStatus}
+		if state := ticket.currentState(); state != test.want {
+			t.Errorf("currentState(%q, %q) = %s, want %s", test.status, test.repairStatus, state, test.want)
+		}
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}